@@ -1,6 +1,8 @@
 package log5go
 
 import (
+	"fmt"
+	"os"
 	"time"
 )
 
@@ -8,10 +10,39 @@ import (
 // a destination. Log5Go provides rich support for appending to files, the console,
 // and to arbitrary writers. Developers can extend log5go by implementing a custom
 // Appender and configuring their logger with ToAppender(a).
+//
+// The msg slice is only valid until Append returns: loggers reuse its memory for
+// later messages. An appender may append to msg (e.g. to terminate it with a newline)
+// but must not change its contents, which are shared by all of a logger's appenders.
+// An appender that holds on to the message, for instance to send it asynchronously,
+// must copy it first.
+//
+// Loggers call Append on a custom appender from one goroutine at a time, unless the
+// appender implements ConcurrentAppender.
 type Appender interface {
 	Append(msg *[]byte, level LogLevel, tstamp time.Time) error
 }
 
+// ConcurrentAppender is implemented by appenders that do their own locking. Loggers
+// don't serialize calls to Append on an appender whose Concurrent method returns true,
+// so messages from many goroutines are appended as soon as they are formatted.
+// All of log5go's appenders are concurrent.
+type ConcurrentAppender interface {
+	Appender
+	Concurrent() bool
+}
+
+// DefaultFlushTimeout is how long a logger waits for its appenders to send the messages
+// they hold after logging a FATAL message
+const DefaultFlushTimeout = 5 * time.Second
+
+// Flusher is implemented by appenders that send messages in the background, like the
+// Fluent and Loki appenders. Flush sends the messages the appender holds, waiting up to
+// timeout, and returns an error if some of them are still unsent.
+type Flusher interface {
+	Flush(timeout time.Duration) error
+}
+
 // TerminateMessageWithNewline function tests msg content and adds a terminating
 // newline if not there already. If you write a custom appender and want line
 // termination, you should call this function on the msg before writing it.
@@ -20,3 +51,10 @@ func TerminateMessageWithNewline(msg *[]byte) {
 		*msg = append(*msg, '\n')
 	}
 }
+
+// reportError writes an appender's error to stderr, for errors that can't be logged
+// through the appender itself
+func reportError(format string, a ...interface{}) {
+	notice := []byte("log5go: " + fmt.Sprintf(format, a...) + "\n")
+	newWriterAppender(os.Stderr, nil).Append(&notice, LogError, time.Now())
+}
@@ -1,7 +1,12 @@
 package log5go
 
 import (
+	"bytes"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 var appenderTests = map[string]string{
@@ -20,3 +25,78 @@ func TestTerminateWithNewline(t *testing.T) {
 		}
 	}
 }
+
+// checkingAppender fails the test if Append is called concurrently
+type checkingAppender struct {
+	t        *testing.T
+	inAppend int32
+	count    int32
+}
+
+func (a *checkingAppender) Append(msg *[]byte, level LogLevel, tstamp time.Time) error {
+	if !atomic.CompareAndSwapInt32(&a.inAppend, 0, 1) {
+		a.t.Error("Append called concurrently on a non-concurrent appender")
+	}
+	time.Sleep(10 * time.Microsecond)
+	a.count++
+	atomic.StoreInt32(&a.inAppend, 0)
+	return nil
+}
+
+func TestCustomAppenderIsSerialized(t *testing.T) {
+	a := &checkingAppender{t: t}
+	l := Logger(LogAll).ToAppender(a)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				l.Info("message %d", j)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if a.count != 400 {
+		t.Errorf("expected 400 messages but got %d", a.count)
+	}
+}
+
+func TestBuiltinAppendersAreConcurrent(t *testing.T) {
+	var appenders = []Appender{&writerAppender{}, &fileAppender{}, &syslogAppender{}}
+	for _, a := range appenders {
+		ca, ok := a.(ConcurrentAppender)
+		if !ok || !ca.Concurrent() {
+			t.Errorf("expected %T to be concurrent", a)
+		}
+	}
+}
+
+func TestConcurrentLogging(t *testing.T) {
+	var buf bytes.Buffer
+	l := Logger(LogAll).ToWriter(&buf).WithFmt("%m").Json()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				l.WithData(Data{"goroutine": i}).Info("message %d", j)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 400 {
+		t.Fatalf("expected 400 lines but got %d", len(lines))
+	}
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "{") || !strings.HasSuffix(line, "}") {
+			t.Errorf("garbled line: %s", line)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package log5go
+
+import (
+	"io"
+	"testing"
+)
+
+// Benchmarks for the logging hot path. All of them log to a discarding appender,
+// so they measure log5go itself and not I/O.
+
+func newDiscardLogger(level LogLevel) Log5Go {
+	return Logger(level).ToWriter(io.Discard)
+}
+
+func Test_FilteredMessagesDontAllocate(t *testing.T) {
+	l := newDiscardLogger(LogWarn)
+	allocs := testing.AllocsPerRun(100, func() {
+		l.Debug("not logged")
+	})
+	if allocs != 0 {
+		t.Errorf("expected no allocations but got %f", allocs)
+	}
+}
+
+func Test_PlainMessagesDontAllocate(t *testing.T) {
+	var tests = map[string]Log5Go{
+		"text":  newDiscardLogger(LogAll).WithPrefix("prefix"),
+		"json":  newDiscardLogger(LogAll).WithPrefix("prefix").Json(),
+		"lines": newDiscardLogger(LogAll).WithShortLines(),
+	}
+
+	for name, l := range tests {
+		allocs := testing.AllocsPerRun(100, func() {
+			l.Info("hello, world")
+		})
+		if allocs != 0 {
+			t.Errorf("%s: expected no allocations but got %f", name, allocs)
+		}
+	}
+}
+
+func Test_WithDataOnlyAllocatesTheBoundLogger(t *testing.T) {
+	d := Data{"str": "bar", "int": 42, "float": 3.14, "bool": true}
+	var tests = map[string]Log5Go{
+		"text": newDiscardLogger(LogAll).WithPrefix("prefix"),
+		"json": newDiscardLogger(LogAll).WithPrefix("prefix").Json(),
+	}
+
+	for name, l := range tests {
+		bind := testing.AllocsPerRun(100, func() {
+			l.WithData(d)
+		})
+		allocs := testing.AllocsPerRun(100, func() {
+			l.WithData(d).Info("hello, world")
+		})
+		if allocs != bind {
+			t.Errorf("%s: expected %f allocations, for WithData, but got %f", name, bind, allocs)
+		}
+
+		bl := l.WithData(d)
+		allocs = testing.AllocsPerRun(100, func() {
+			bl.Info("hello, world")
+		})
+		if allocs != 0 {
+			t.Errorf("%s: expected no allocations logging with a bound logger but got %f", name, allocs)
+		}
+	}
+}
+
+func BenchmarkFiltered(b *testing.B) {
+	l := newDiscardLogger(LogWarn)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		l.Debug("hello, %s", "world")
+	}
+}
+
+func BenchmarkText(b *testing.B) {
+	l := newDiscardLogger(LogAll).WithPrefix("prefix")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		l.Info("hello, world")
+	}
+}
+
+func BenchmarkTextArgs(b *testing.B) {
+	l := newDiscardLogger(LogAll).WithPrefix("prefix")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		l.Info("hello, %s %d", "world", i)
+	}
+}
+
+func BenchmarkJson(b *testing.B) {
+	l := newDiscardLogger(LogAll).WithPrefix("prefix").Json()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		l.Info("hello, world")
+	}
+}
+
+// BenchmarkTextData and BenchmarkJsonData include WithData's allocations: the bound
+// logger and its copy of the data
+func BenchmarkTextData(b *testing.B) {
+	l := newDiscardLogger(LogAll).WithPrefix("prefix")
+	d := Data{"str": "bar", "int": 42, "float": 3.14, "bool": true}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		l.WithData(d).Info("hello, world")
+	}
+}
+
+func BenchmarkJsonData(b *testing.B) {
+	l := newDiscardLogger(LogAll).WithPrefix("prefix").Json()
+	d := Data{"str": "bar", "int": 42, "float": 3.14, "bool": true}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		l.WithData(d).Info("hello, world")
+	}
+}
+
+func BenchmarkShortLines(b *testing.B) {
+	l := newDiscardLogger(LogAll).WithShortLines()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		l.Info("hello, world")
+	}
+}
+
+func BenchmarkLongLines(b *testing.B) {
+	l := newDiscardLogger(LogAll).WithLongLines()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		l.Info("hello, world")
+	}
+}
+
+func BenchmarkFuncName(b *testing.B) {
+	l := newDiscardLogger(LogAll).WithFmt("%t %l %f: %m")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		l.Info("hello, world")
+	}
+}
+
+func BenchmarkTextParallel(b *testing.B) {
+	l := newDiscardLogger(LogAll).WithPrefix("prefix")
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			l.Info("hello, world")
+		}
+	})
+}
+
+func BenchmarkJsonDataParallel(b *testing.B) {
+	l := newDiscardLogger(LogAll).WithPrefix("prefix").Json()
+	d := Data{"str": "bar", "int": 42, "float": 3.14, "bool": true}
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			l.WithData(d).Info("hello, world")
+		}
+	})
+}
@@ -1,7 +1,7 @@
 package log5go
 
 import (
-	"fmt"
+	"crypto/tls"
 	"io"
 	"time"
 )
@@ -19,59 +19,150 @@ type Data map[string]interface{}
 // object can be reused. Calling LogBuilder methods on a boundLogger object result in
 // a NOOP to keep developers from doing silly things.
 type boundLogger struct {
-	l    *logger
-	data Data
+	l        *logger
+	data     Data
+	sampling *samplePolicy // nil unless created by EveryN, Every or Once
 }
 
 //-- Log5GoData interface ------------
 
+// WithData returns a new bound logger with d merged into the bound data. The bound
+// data is copied rather than modified, so a bound logger can be shared by goroutines.
 func (l *boundLogger) WithData(d Data) Log5Go {
+	data := make(Data, len(l.data)+len(d))
+	for key, value := range l.data {
+		data[key] = value
+	}
 	for key, value := range d {
-		l.data[key] = value
+		data[key] = value
 	}
-	return l
+	return &boundLogger{l: l.l, data: data, sampling: l.sampling}
 }
 
 //-- Log5Go interface ------------
 
 func (l *boundLogger) Log(level LogLevel, format string, a ...interface{}) {
-	l.l.log(time.Now(), level, 2, fmt.Sprintf(format, a...), l.data)
+	if data, ok := l.sample(level); ok {
+		l.l.log(level, 2, format, a, data)
+	}
 }
 
 func (l *boundLogger) Trace(format string, a ...interface{}) {
-	l.l.log(time.Now(), LogTrace, 2, fmt.Sprintf(format, a...), l.data)
+	if data, ok := l.sample(LogTrace); ok {
+		l.l.log(LogTrace, 2, format, a, data)
+	}
 }
 
 func (l *boundLogger) Debug(format string, a ...interface{}) {
-	l.l.log(time.Now(), LogDebug, 2, fmt.Sprintf(format, a...), l.data)
+	if data, ok := l.sample(LogDebug); ok {
+		l.l.log(LogDebug, 2, format, a, data)
+	}
 }
 
 func (l *boundLogger) Info(format string, a ...interface{}) {
-	l.l.log(time.Now(), LogInfo, 2, fmt.Sprintf(format, a...), l.data)
+	if data, ok := l.sample(LogInfo); ok {
+		l.l.log(LogInfo, 2, format, a, data)
+	}
 }
 
 func (l *boundLogger) Notice(format string, a ...interface{}) {
-	l.l.log(time.Now(), LogNotice, 2, fmt.Sprintf(format, a...), l.data)
+	if data, ok := l.sample(LogNotice); ok {
+		l.l.log(LogNotice, 2, format, a, data)
+	}
 }
 
 func (l *boundLogger) Warn(format string, a ...interface{}) {
-	l.l.log(time.Now(), LogWarn, 2, fmt.Sprintf(format, a...), l.data)
+	if data, ok := l.sample(LogWarn); ok {
+		l.l.log(LogWarn, 2, format, a, data)
+	}
 }
 
 func (l *boundLogger) Error(format string, a ...interface{}) {
-	l.l.log(time.Now(), LogError, 2, fmt.Sprintf(format, a...), l.data)
+	if data, ok := l.sample(LogError); ok {
+		l.l.log(LogError, 2, format, a, data)
+	}
 }
 
 func (l *boundLogger) Critical(format string, a ...interface{}) {
-	l.l.log(time.Now(), LogCritical, 2, fmt.Sprintf(format, a...), l.data)
+	if data, ok := l.sample(LogCritical); ok {
+		l.l.log(LogCritical, 2, format, a, data)
+	}
 }
 
 func (l *boundLogger) Alert(format string, a ...interface{}) {
-	l.l.log(time.Now(), LogAlert, 2, fmt.Sprintf(format, a...), l.data)
+	if data, ok := l.sample(LogAlert); ok {
+		l.l.log(LogAlert, 2, format, a, data)
+	}
 }
 
 func (l *boundLogger) Fatal(format string, a ...interface{}) {
-	l.l.log(time.Now(), LogFatal, 2, fmt.Sprintf(format, a...), l.data)
+	if data, ok := l.sample(LogFatal); ok {
+		l.l.log(LogFatal, 2, format, a, data)
+	}
+}
+
+func (l *boundLogger) LogFn(level LogLevel, fn func() string) {
+	if data, ok := l.sample(level); ok {
+		l.l.logFn(level, 2, fn, data)
+	}
+}
+
+func (l *boundLogger) TraceFn(fn func() string) {
+	if data, ok := l.sample(LogTrace); ok {
+		l.l.logFn(LogTrace, 2, fn, data)
+	}
+}
+
+func (l *boundLogger) DebugFn(fn func() string) {
+	if data, ok := l.sample(LogDebug); ok {
+		l.l.logFn(LogDebug, 2, fn, data)
+	}
+}
+
+func (l *boundLogger) InfoFn(fn func() string) {
+	if data, ok := l.sample(LogInfo); ok {
+		l.l.logFn(LogInfo, 2, fn, data)
+	}
+}
+
+func (l *boundLogger) NoticeFn(fn func() string) {
+	if data, ok := l.sample(LogNotice); ok {
+		l.l.logFn(LogNotice, 2, fn, data)
+	}
+}
+
+func (l *boundLogger) WarnFn(fn func() string) {
+	if data, ok := l.sample(LogWarn); ok {
+		l.l.logFn(LogWarn, 2, fn, data)
+	}
+}
+
+func (l *boundLogger) ErrorFn(fn func() string) {
+	if data, ok := l.sample(LogError); ok {
+		l.l.logFn(LogError, 2, fn, data)
+	}
+}
+
+func (l *boundLogger) CriticalFn(fn func() string) {
+	if data, ok := l.sample(LogCritical); ok {
+		l.l.logFn(LogCritical, 2, fn, data)
+	}
+}
+
+func (l *boundLogger) AlertFn(fn func() string) {
+	if data, ok := l.sample(LogAlert); ok {
+		l.l.logFn(LogAlert, 2, fn, data)
+	}
+}
+
+func (l *boundLogger) FatalFn(fn func() string) {
+	if data, ok := l.sample(LogFatal); ok {
+		l.l.logFn(LogFatal, 2, fn, data)
+	}
+}
+
+func (l *boundLogger) AtLevel(level LogLevel) LevelLogger {
+	return &levelLogger{l: l.l, bound: l, level: level}
 }
 
 func (l *boundLogger) LogLevel() LogLevel {
@@ -82,6 +173,10 @@ func (l *boundLogger) SetLogLevel(level LogLevel) {
 	// NOOP
 }
 
+func (l *boundLogger) Flush(timeout time.Duration) error {
+	return l.l.Flush(timeout)
+}
+
 //-- LogBuilder interface -----------------
 
 func (l *boundLogger) Clone() Log5Go {
@@ -124,6 +219,96 @@ func (l *boundLogger) WithShortLines() Log5Go {
 	return l
 }
 
+func (l *boundLogger) WithStackTrace(level LogLevel) Log5Go {
+	// NOOP
+	return l
+}
+
+func (l *boundLogger) WithHook(h Hook) Log5Go {
+	// NOOP
+	return l
+}
+
+func (l *boundLogger) WithRedaction(r *Redactor) Log5Go {
+	// NOOP
+	return l
+}
+
+func (l *boundLogger) ToJournald(identifier string) Log5Go {
+	// NOOP
+	return l
+}
+
+func (l *boundLogger) ToGELF(transport string, addr string) Log5Go {
+	// NOOP
+	return l
+}
+
+func (l *boundLogger) WithGELFCompression(enabled bool) Log5Go {
+	// NOOP
+	return l
+}
+
+func (l *boundLogger) WithGELFChunkSize(size int) Log5Go {
+	// NOOP
+	return l
+}
+
+func (l *boundLogger) WithGELFWriteTimeout(timeout time.Duration) Log5Go {
+	// NOOP
+	return l
+}
+
+func (l *boundLogger) ToFluent(transport string, addr string, tag string) Log5Go {
+	// NOOP
+	return l
+}
+
+func (l *boundLogger) WithFluentBatch(size int, interval time.Duration) Log5Go {
+	// NOOP
+	return l
+}
+
+func (l *boundLogger) WithFluentAck(timeout time.Duration) Log5Go {
+	// NOOP
+	return l
+}
+
+func (l *boundLogger) ToLoki(pushURL string) Log5Go {
+	// NOOP
+	return l
+}
+
+func (l *boundLogger) WithLokiLabels(keys ...string) Log5Go {
+	// NOOP
+	return l
+}
+
+func (l *boundLogger) WithLokiBatch(maxBytes int, wait time.Duration) Log5Go {
+	// NOOP
+	return l
+}
+
+func (l *boundLogger) WithLokiCompression(enabled bool) Log5Go {
+	// NOOP
+	return l
+}
+
+func (l *boundLogger) WithAppender(appender Appender) Log5Go {
+	// NOOP
+	return l
+}
+
+func (l *boundLogger) WithStderrLevel(level LogLevel) Log5Go {
+	// NOOP
+	return l
+}
+
+func (l *boundLogger) WithStderrFilter(filters ...Filter) Log5Go {
+	// NOOP
+	return l
+}
+
 func (l *boundLogger) ToFile(directory string, filename string) Log5Go {
 	// NOOP
 	return l
@@ -144,6 +329,16 @@ func (l *boundLogger) WithStderr() Log5Go {
 	return l
 }
 
+func (l *boundLogger) WithColor() Log5Go {
+	// NOOP
+	return l
+}
+
+func (l *boundLogger) WithColorPalette(palette ColorPalette) Log5Go {
+	// NOOP
+	return l
+}
+
 func (l *boundLogger) WithFmt(format string) Log5Go {
 	// NOOP
 	return l
@@ -154,6 +349,11 @@ func (l *boundLogger) Json() Log5Go {
 	return l
 }
 
+func (l *boundLogger) JsonWithSchema(schema JsonSchema) Log5Go {
+	// NOOP
+	return l
+}
+
 func (l *boundLogger) Register(key string) Log5Go {
 	// NOOP
 	return l
@@ -168,3 +368,58 @@ func (l *boundLogger) ToRemoteSyslog(facility SyslogPriority, tag string, transp
 	// NOOP
 	return l
 }
+
+func (l *boundLogger) ToRemoteSyslogTLS(facility SyslogPriority, tag string, addr string, config *tls.Config) Log5Go {
+	// NOOP
+	return l
+}
+
+func (l *boundLogger) WithSyslogBacklog(size int) Log5Go {
+	// NOOP
+	return l
+}
+
+func (l *boundLogger) WithSyslogFallback(fallback Appender) Log5Go {
+	// NOOP
+	return l
+}
+
+func (l *boundLogger) WithSyslogBackoff(min, max time.Duration) Log5Go {
+	// NOOP
+	return l
+}
+
+func (l *boundLogger) WithSyslogWriteTimeout(timeout time.Duration) Log5Go {
+	// NOOP
+	return l
+}
+
+func (l *boundLogger) WithSyslogHeader(header SyslogHeader) Log5Go {
+	// NOOP
+	return l
+}
+
+func (l *boundLogger) WithSyslogProtocol(protocol SyslogProtocol) Log5Go {
+	// NOOP
+	return l
+}
+
+func (l *boundLogger) WithSyslogFraming(framing SyslogFraming) Log5Go {
+	// NOOP
+	return l
+}
+
+func (l *boundLogger) WithSyslogSeverity(severity SyslogSeverityFunc) Log5Go {
+	// NOOP
+	return l
+}
+
+func (l *boundLogger) WithSyslogHostname(source SyslogHostname) Log5Go {
+	// NOOP
+	return l
+}
+
+func (l *boundLogger) WithSyslogTime(utc bool, precision int) Log5Go {
+	// NOOP
+	return l
+}
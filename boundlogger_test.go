@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"os"
 	"testing"
+	"time"
 )
 
 // var boundLoggerTests = []loggerTest{
@@ -87,6 +88,21 @@ func TestBoundLoggerBuilderNoops(t *testing.T) {
 		t.Error("lines changed")
 	}
 
+	bl2 = bl.WithHook(HookFunc(func(e *Entry) bool { return false }))
+	if bl2 != bl || len(l.hooks) != 0 {
+		t.Error("hooks changed")
+	}
+
+	bl2 = bl.WithRedaction(NewRedactor("", DefaultRedactionRules...))
+	if bl2 != bl || l.redactor != nil {
+		t.Error("redactor changed")
+	}
+
+	bl2 = bl.WithAppender(&writerAppender{dest: os.Stdout})
+	if bl2 != bl || len(l.appenders) != 0 {
+		t.Error("appenders changed")
+	}
+
 	bl2 = bl.ToFile("/tmp", "foo.log")
 	if bl2 != bl || l.appender != appender {
 		t.Error("appender changed")
@@ -111,7 +127,7 @@ func TestBoundLoggerBuilderNoops(t *testing.T) {
 	if bl2 != bl || l.formatter != formatter {
 		t.Error("formatter changed")
 	}
-	if len(formatter.parts) != 1 || formatter.parts[0] != "%m" {
+	if len(formatter.parts) != 1 || formatter.parts[0].String() != "%m" {
 		t.Error("formatter changed")
 	}
 
@@ -139,4 +155,104 @@ func TestBoundLoggerBuilderNoops(t *testing.T) {
 	if bl2 != bl || l.appender != appender {
 		t.Error("appender changed")
 	}
+
+	bl2 = bl.ToJournald("foo")
+	if bl2 != bl || l.appender != appender {
+		t.Error("appender changed")
+	}
+
+	bl2 = bl.ToGELF("udp", "localhost:12201")
+	if bl2 != bl || l.appender != appender {
+		t.Error("appender changed")
+	}
+
+	bl2 = bl.WithGELFCompression(true)
+	if bl2 != bl || l.appender != appender {
+		t.Error("appender changed")
+	}
+
+	bl2 = bl.WithGELFChunkSize(8154)
+	if bl2 != bl || l.appender != appender {
+		t.Error("appender changed")
+	}
+
+	bl2 = bl.WithGELFWriteTimeout(time.Second)
+	if bl2 != bl || l.appender != appender {
+		t.Error("appender changed")
+	}
+
+	bl2 = bl.ToFluent("tcp", "localhost:24224", "app.web")
+	if bl2 != bl || l.appender != appender {
+		t.Error("appender changed")
+	}
+
+	bl2 = bl.WithFluentBatch(10, time.Second)
+	if bl2 != bl || l.appender != appender {
+		t.Error("appender changed")
+	}
+
+	bl2 = bl.WithFluentAck(time.Second)
+	if bl2 != bl || l.appender != appender {
+		t.Error("appender changed")
+	}
+
+	bl2 = bl.ToLoki("http://localhost:3100")
+	if bl2 != bl || l.appender != appender {
+		t.Error("appender changed")
+	}
+
+	bl2 = bl.WithLokiLabels("service")
+	if bl2 != bl || l.appender != appender {
+		t.Error("appender changed")
+	}
+
+	bl2 = bl.WithLokiBatch(1<<10, time.Second)
+	if bl2 != bl || l.appender != appender {
+		t.Error("appender changed")
+	}
+
+	bl2 = bl.WithLokiCompression(true)
+	if bl2 != bl || l.appender != appender {
+		t.Error("appender changed")
+	}
+
+	bl2 = bl.ToRemoteSyslogTLS(SyslogLocal2, "foo", "localhost:6514", nil)
+	if bl2 != bl || l.appender != appender {
+		t.Error("appender changed")
+	}
+
+	bl2 = bl.WithSyslogFraming(SyslogOctetCounting)
+	if bl2 != bl || l.appender != appender {
+		t.Error("appender changed")
+	}
+
+	bl2 = bl.WithSyslogHeader(SyslogHeader{AppName: "foo"})
+	if bl2 != bl || l.appender != appender {
+		t.Error("appender changed")
+	}
+
+	bl2 = bl.WithSyslogSeverity(DefaultSyslogSeverity)
+	if bl2 != bl || l.appender != appender {
+		t.Error("appender changed")
+	}
+
+	bl2 = bl.WithSyslogHostname(SyslogHostnameIP)
+	if bl2 != bl || l.appender != appender {
+		t.Error("appender changed")
+	}
+
+	bl2 = bl.WithSyslogTime(true, 3)
+	if bl2 != bl || l.appender != appender {
+		t.Error("appender changed")
+	}
+
+	bl2 = bl.WithSyslogProtocol(SyslogRFC3164)
+	if bl2 != bl || l.appender != appender {
+		t.Error("appender changed")
+	}
+
+	bl2 = bl.WithSyslogWriteTimeout(time.Second)
+	if bl2 != bl || l.appender != appender {
+		t.Error("appender changed")
+	}
 }
@@ -1,9 +1,10 @@
 package log5go
 
 import (
-	"fmt"
+	"crypto/tls"
 	"io"
 	"net"
+	"net/url"
 	"os"
 	"path/filepath"
 	"time"
@@ -14,28 +15,43 @@ func Logger(level LogLevel) Log5Go {
 	logger := logger{
 		level:      level,
 		formatter:  NewStringFormatter(FMT_Default),
-		appender:   &writerAppender{dest: os.Stderr, errDest: nil},
+		appender:   newWriterAppender(os.Stderr, nil),
 		timeFormat: TF_GoStd,
 		prefix:     "",
 		lines:      0,
+		created:    time.Now(),
 	}
 	return &logger
 }
 
 func (l *logger) Clone() Log5Go {
-	return &logger{
+	c := &logger{
 		level:      l.level,
 		formatter:  l.formatter,
 		appender:   l.appender,
 		timeFormat: l.timeFormat,
 		prefix:     l.prefix,
 		lines:      l.lines,
+		created:    l.created,
+		stacks:     l.stacks,
+		stackLevel: l.stackLevel,
+		palette:    l.palette,
+		hooks:      append([]Hook(nil), l.hooks...),
+		redactor:   l.redactor,
+		appenders:  append([]Appender(nil), l.appenders...),
+		fields:     l.fields,
+		root:       l.root,
+		sharedApp:  true,
 	}
+	c.sharedFmt.Store(true)
+	l.sharedFmt.Store(true)
+	return c
 }
 
 // Add a custom format to the logger
 func (l *logger) WithTimeFmt(format string) Log5Go {
 	l.timeFormat = format
+	l.ownFormatter()
 	l.formatter.SetTimeFormat(format)
 	return l
 }
@@ -43,14 +59,14 @@ func (l *logger) WithTimeFmt(format string) Log5Go {
 // Select the console appender set to stdout. You must select an appender only once.
 // You must select an appender prior to configuring it.
 func (l *logger) ToStdout() Log5Go {
-	l.appender = &writerAppender{dest: os.Stdout, errDest: nil}
+	l.setAppender(newWriterAppender(os.Stdout, nil))
 	return l
 }
 
 // Select the console appender set to stderr. You must select an appender only once.
 // You must select an appender prior to configuring it.
 func (l *logger) ToStderr() Log5Go {
-	l.appender = &writerAppender{dest: os.Stderr, errDest: nil}
+	l.setAppender(newWriterAppender(os.Stderr, nil))
 	return l
 }
 
@@ -58,7 +74,7 @@ func (l *logger) ToStderr() Log5Go {
 // You must select an appender only once.
 // You must select an appender prior to configuring it.
 func (l *logger) ToWriter(out io.Writer) Log5Go {
-	l.appender = &writerAppender{dest: out, errDest: nil}
+	l.setAppender(newWriterAppender(out, nil))
 	return l
 }
 
@@ -80,24 +96,59 @@ func (l *logger) WithShortLines() Log5Go {
 	return l
 }
 
+// WithStackTrace attaches the caller's stack to every message logged at or above level
+func (l *logger) WithStackTrace(level LogLevel) Log5Go {
+	l.stacks = true
+	l.stackLevel = level
+	return l
+}
+
+// WithHook adds a hook that is run on every message before it is formatted. Hooks
+// run in the order they were added.
+func (l *logger) WithHook(h Hook) Log5Go {
+	l.hooks = append(l.hooks, h)
+	return l
+}
+
+// WithRedaction removes sensitive data from every message using r. Redaction happens
+// after hooks have run, before the message is formatted.
+func (l *logger) WithRedaction(r *Redactor) Log5Go {
+	l.redactor = r
+	return l
+}
+
 // Select the file appender. You must select an appender only once.
 // You must select an appender prior to configuring it.
 func (l *logger) ToFile(directory string, filename string) Log5Go {
+	if appender, err := openFileAppender(directory, filename); err == nil {
+		l.setAppender(appender)
+	}
+	return l
+}
+
+// NewFileAppender creates an appender for the given log file, for use with WithAppender().
+// Like ToFile(), all appenders for the same file share their state.
+func NewFileAppender(directory string, filename string) (Appender, error) {
+	return openFileAppender(directory, filename)
+}
+
+// openFileAppender returns the file appender for the given file, creating it if necessary
+func openFileAppender(directory string, filename string) (*fileAppender, error) {
 	expandedDir, err := filepath.Abs(directory)
 	if err != nil {
-		// would be nice to do *something* on error, but not sure what
-		return l
+		return nil, err
 	}
 
 	fullFilename := filepath.Join(expandedDir, filename)
 
 	fileAppenderMapLock.Lock()
+	defer fileAppenderMapLock.Unlock()
+
 	var appender = fileAppenderMap[fullFilename]
 	if appender == nil {
 		logfile, err := os.OpenFile(fullFilename, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0666)
 		if err != nil {
-			fileAppenderMapLock.Unlock()
-			return l
+			return nil, err
 		}
 		appender = &fileAppender{
 			f:             logfile,
@@ -114,86 +165,455 @@ func (l *logger) ToFile(directory string, filename string) Log5Go {
 		go periodicFileWatcher()
 		fileRollerRunning = true
 	}
-	fileAppenderMapLock.Unlock()
 
-	l.appender = appender
-	return l
+	return appender, nil
 }
 
 // ToAppender sets a custom (i.e third-party) appender as the destination for this logger.
 // No other appender setting methods must be called before or after.
 func (l *logger) ToAppender(appender Appender) Log5Go {
-	l.appender = appender
+	l.setAppender(appender)
+	return l
+}
+
+// ToJournald sets a journald appender that sends messages to the local systemd journal
+// with the given SYSLOG_IDENTIFIER. The caller's file, line and function and every data
+// key become journal fields. If journald can't be reached, an error message is
+// immediately logged and messages go to stderr.
+func (l *logger) ToJournald(identifier string) Log5Go {
+	if err := l.toJournald(journaldSocket, identifier); err != nil {
+		l.setAppender(newWriterAppender(os.Stderr, os.Stderr))
+		l.Error("UNABLE TO CONNECT TO JOURNALD: %v", err)
+	}
+	return l
+}
+
+// toJournald sets a journald formatter and an appender connected to the socket at path
+func (l *logger) toJournald(path string, identifier string) error {
+	a := newJournaldAppender(path, identifier)
+	if err := a.open(); err != nil {
+		return err
+	}
+	l.setAppender(a)
+	l.formatter = newJournaldFormatter()
+	l.sharedFmt.Store(false)
+	return nil
+}
+
+// ToGELF sets a GELF appender that sends messages to a Graylog server over "udp" or "tcp".
+// The caller's file and line and every data key are sent as additional fields. If the
+// server can't be reached, an error message is written to stderr and messages are
+// dropped until a connection attempt succeeds.
+func (l *logger) ToGELF(transport string, addr string) Log5Go {
+	var stream bool
+	switch transport {
+	case "udp", "udp4", "udp6":
+	case "tcp", "tcp4", "tcp6":
+		stream = true
+	default:
+		l.setAppender(newWriterAppender(os.Stderr, os.Stderr))
+		l.Error("INVALID GELF TRANSPORT: %s", transport)
+		return l
+	}
+
+	a := newGELFAppender(func() (net.Conn, error) {
+		return net.DialTimeout(transport, addr, syslogDialTimeout)
+	}, stream)
+	l.setAppender(a)
+	l.formatter = newRecordFormatter()
+	l.sharedFmt.Store(false)
+
+	if err := a.connect(); err != nil {
+		a.nextDial = time.Now().Add(gelfRedialInterval)
+		reportError("unable to connect to GELF server %s: %v", addr, err)
+	}
+	return l
+}
+
+// WithGELFCompression gzips GELF messages sent over UDP. ToGELF() must have been called already.
+func (l *logger) WithGELFCompression(enabled bool) Log5Go {
+	if a, ok := l.ownAppender().(*gelfAppender); ok {
+		a.Lock()
+		a.compress = enabled
+		a.Unlock()
+	}
+	return l
+}
+
+// WithGELFChunkSize sets the largest UDP datagram sent to the GELF server. Larger messages
+// are split into chunks. The default is DefaultGELFChunkSize. ToGELF() must have been
+// called already.
+func (l *logger) WithGELFChunkSize(size int) Log5Go {
+	if a, ok := l.ownAppender().(*gelfAppender); ok && size > gelfChunkHeader {
+		a.Lock()
+		a.chunkSize = size
+		a.Unlock()
+	}
+	return l
+}
+
+// WithGELFWriteTimeout sets how long a write to the GELF server may take. Messages are
+// dropped while the server is stalled. The default is DefaultGELFWriteTimeout, 0 for no
+// limit. ToGELF() must have been called already.
+func (l *logger) WithGELFWriteTimeout(timeout time.Duration) Log5Go {
+	if a, ok := l.ownAppender().(*gelfAppender); ok {
+		a.Lock()
+		a.timeout = timeout
+		a.Unlock()
+	}
+	return l
+}
+
+// ToFluent sets a Fluent appender that sends messages to Fluentd or Fluent Bit using the
+// forward protocol, over "tcp" or "unix", with the given tag. Messages are sent in
+// batches; the caller's file and line and every data key are record fields. If the
+// server can't be reached, an error message is written to stderr and messages are kept
+// until a connection attempt succeeds.
+func (l *logger) ToFluent(transport string, addr string, tag string) Log5Go {
+	switch transport {
+	case "tcp", "tcp4", "tcp6", "unix":
+	default:
+		l.setAppender(newWriterAppender(os.Stderr, os.Stderr))
+		l.Error("INVALID FLUENT TRANSPORT: %s", transport)
+		return l
+	}
+
+	a := newFluentAppender(func() (net.Conn, error) {
+		return net.DialTimeout(transport, addr, syslogDialTimeout)
+	}, tag)
+	l.setAppender(a)
+	l.formatter = newRecordFormatter()
+	l.sharedFmt.Store(false)
+
+	conn, err := a.dial()
+	if err != nil {
+		a.nextDial = time.Now().Add(fluentRedialInterval)
+		reportError("unable to connect to Fluent server %s: %v", addr, err)
+		return l
+	}
+	a.conn = conn
+	return l
+}
+
+// WithFluentBatch sets the number of messages sent together to the Fluent server, and the
+// longest a message waits for its batch to fill. The defaults are DefaultFluentBatchSize
+// and DefaultFluentFlushInterval. ToFluent() must have been called already.
+func (l *logger) WithFluentBatch(size int, interval time.Duration) Log5Go {
+	if a, ok := l.ownAppender().(*fluentAppender); ok && size > 0 && interval > 0 {
+		a.Lock()
+		a.batchSize = size
+		a.flushInterval = interval
+		a.Unlock()
+	}
+	return l
+}
+
+// WithFluentAck makes the Fluent server acknowledge each batch. A batch that isn't
+// acknowledged within timeout is sent again on a new connection, so messages are
+// delivered at least once. A timeout of 0 disables acks. ToFluent() must have been
+// called already.
+func (l *logger) WithFluentAck(timeout time.Duration) Log5Go {
+	if a, ok := l.ownAppender().(*fluentAppender); ok && timeout >= 0 {
+		a.Lock()
+		a.ackTimeout = timeout
+		a.Unlock()
+	}
+	return l
+}
+
+// ToLoki sets a Loki appender that pushes messages to the Grafana Loki server at
+// pushURL. If pushURL has no path, the push API at /loki/api/v1/push is used. Messages
+// are labeled with their level and the logger's prefix; see WithLokiLabels(). If the
+// server can't be reached, or rejects a push with 429 or 5xx, the push is retried with
+// exponential backoff.
+func (l *logger) ToLoki(pushURL string) Log5Go {
+	u, err := url.Parse(pushURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		l.setAppender(newWriterAppender(os.Stderr, os.Stderr))
+		l.Error("INVALID LOKI URL: %s", pushURL)
+		return l
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = lokiPushPath
+	}
+
+	l.setAppender(newLokiAppender(u.String()))
+	l.formatter = newLokiFormatter(l.lines != 0)
+	l.sharedFmt.Store(false)
+	return l
+}
+
+// WithLokiLabels sends the given data keys as labels, rather than as part of the line.
+// Keys should have few distinct values, as each set of labels is a separate stream in
+// Loki. ToLoki() must have been called already.
+func (l *logger) WithLokiLabels(keys ...string) Log5Go {
+	a, ok := l.ownAppender().(*lokiAppender)
+	if !ok {
+		return l
+	}
+	labels := append([]string(nil), keys...)
+	a.Lock()
+	a.labels = labels
+	a.Unlock()
+
+	l.ownFormatter()
+	if f, ok := l.formatter.(*lokiFormatter); ok {
+		f.labels = labels
+	}
+	return l
+}
+
+// WithLokiBatch sets the size of the lines pushed together to Loki, and the longest a
+// message waits for its batch to fill. The defaults are DefaultLokiBatchBytes and
+// DefaultLokiBatchWait. ToLoki() must have been called already.
+func (l *logger) WithLokiBatch(maxBytes int, wait time.Duration) Log5Go {
+	if a, ok := l.ownAppender().(*lokiAppender); ok && maxBytes > 0 && wait > 0 {
+		a.Lock()
+		a.batchBytes = maxBytes
+		a.batchWait = wait
+		a.Unlock()
+	}
 	return l
 }
 
-// ToLocalSyslog sets a syslog formatter and attempts to set a syslog appender connected
-// to the local syslogd daemon. If this fails, stderr is used instead and an error message
-// is immediately logged.
+// WithLokiCompression gzips the requests pushed to Loki. ToLoki() must have been called already.
+func (l *logger) WithLokiCompression(enabled bool) Log5Go {
+	if a, ok := l.ownAppender().(*lokiAppender); ok {
+		a.Lock()
+		a.compress = enabled
+		a.Unlock()
+	}
+	return l
+}
+
+// WithAppender adds another destination for this logger's messages. Each message is sent
+// to every appender whose filters (see Filtered()) accept it.
+func (l *logger) WithAppender(appender Appender) Log5Go {
+	l.appenders = append(l.appenders, appender)
+	return l
+}
+
+// ToLocalSyslog sets a syslog formatter and a syslog appender connected to the local
+// syslogd daemon. If the connection fails, an error message is immediately logged and
+// messages go to stderr until a reconnection attempt succeeds.
 func (l *logger) ToLocalSyslog(facility SyslogPriority, tag string) Log5Go {
 
 	if facility < SyslogKernel || facility > SyslogLocal7 {
-		l.appender = &writerAppender{dest: os.Stderr, errDest: os.Stderr}
+		l.setAppender(newWriterAppender(os.Stderr, os.Stderr))
 		l.Error("INVALID SYSLOG FACILITY: %d", facility)
 
 		return l
 	}
 
-	var conn net.Conn
-	var err error
-	for _, transport := range socketTypes {
-		for _, socket := range socketLocations {
-			conn, err = net.DialTimeout(transport, socket, time.Second*10)
-			if err != nil {
-				continue
-			} else {
-				l.appender = &syslogAppender{conn: conn, facility: facility, tag: tag}
-				l.formatter = newSyslogFormatter(l.lines != 0)
-				return l
-			}
-		}
+	if err := l.toSyslog(dialLocalSyslog, facility, tag, SyslogNonTransparent); err != nil {
+		l.Error("UNABLE TO CONNECT TO LOCAL SYSLOG PROCESS: %v", err)
 	}
-
-	l.appender = &writerAppender{dest: os.Stderr, errDest: os.Stderr}
-	l.Error("UNABLE TO CONNECT TO LOCAL SYSLOG PROCESS: %v", err)
-
 	return l
 }
 
-// ToRemoteSyslog sets a syslog formatter and attempts to set a syslog appender connected
-// to the remote syslogd daemon. If this fails, stderr is used instead and an error message
-// is immediately logged.
+// ToRemoteSyslog sets a syslog formatter and a syslog appender connected to the remote
+// syslogd daemon. If the connection fails, an error message is immediately logged and
+// messages go to stderr until a reconnection attempt succeeds. Stream transports use
+// octet-counting framing; see WithSyslogFraming().
 func (l *logger) ToRemoteSyslog(facility SyslogPriority, tag string, transport string, addr string) Log5Go {
 
 	if facility < SyslogKernel || facility > SyslogLocal7 {
-		l.appender = &writerAppender{dest: os.Stderr, errDest: os.Stderr}
+		l.setAppender(newWriterAppender(os.Stderr, os.Stderr))
 		l.Error("INVALID SYSLOG FACILITY: %d", facility)
 
 		return l
 	}
 
-	var conn net.Conn
-	var err error
-	fmt.Printf("dialing %s (%s).\n", addr, transport)
+	dial := func() (net.Conn, error) {
+		return net.DialTimeout(transport, addr, syslogDialTimeout)
+	}
+	if err := l.toSyslog(dial, facility, tag, syslogFraming(transport)); err != nil {
+		l.Error("UNABLE TO CONNECT TO REMOTE SYSLOG PROCESS: %v", err)
+	}
+	return l
+}
+
+// ToRemoteSyslogTLS sets a syslog formatter and a syslog appender connected to the remote
+// syslogd daemon over TLS (RFC 5425), with octet-counting framing. A nil config uses the
+// system's root CAs. Connection failures are handled as in ToRemoteSyslog().
+func (l *logger) ToRemoteSyslogTLS(facility SyslogPriority, tag string, addr string, config *tls.Config) Log5Go {
+
+	if facility < SyslogKernel || facility > SyslogLocal7 {
+		l.setAppender(newWriterAppender(os.Stderr, os.Stderr))
+		l.Error("INVALID SYSLOG FACILITY: %d", facility)
 
-	conn, err = net.DialTimeout(transport, addr, time.Second*10)
-	fmt.Printf("finished dialing. error: %v\n", err)
-	if err == nil {
-		l.appender = &syslogAppender{conn: conn, facility: facility, tag: tag}
-		l.formatter = newSyslogFormatter(l.lines != 0)
 		return l
 	}
 
-	l.appender = &writerAppender{dest: os.Stderr, errDest: os.Stderr}
-	l.Error("UNABLE TO CONNECT TO REMOTE SYSLOG PROCESS: %v", err)
+	dial := func() (net.Conn, error) {
+		return tls.DialWithDialer(&net.Dialer{Timeout: syslogDialTimeout}, "tcp", addr, config)
+	}
+	if err := l.toSyslog(dial, facility, tag, SyslogOctetCounting); err != nil {
+		l.Error("UNABLE TO CONNECT TO REMOTE SYSLOG PROCESS: %v", err)
+	}
+	return l
+}
+
+// toSyslog sets a syslog formatter and appender, returning the error if the appender
+// couldn't connect
+func (l *logger) toSyslog(dial func() (net.Conn, error), facility SyslogPriority, tag string, framing SyslogFraming) error {
+	a := newSyslogAppender(dial, facility, tag, framing)
+	a.hostname = lookupSyslogHostname(a.source)
+	l.setAppender(a)
+	l.formatter = newSyslogFormatter(l.lines != 0)
+	l.sharedFmt.Store(false)
+
+	conn, err := dial()
+	if err != nil {
+		a.scheduleReconnect(time.Now())
+		return err
+	}
+	a.conn = conn
+	return nil
+}
+
+// WithSyslogBacklog sets the number of messages a syslog appender keeps while its
+// connection is down, to send once it reconnects. ToLocalSyslog() or ToRemoteSyslog()
+// must have been called already.
+func (l *logger) WithSyslogBacklog(size int) Log5Go {
+	if a, ok := l.ownAppender().(*syslogAppender); ok {
+		a.Lock()
+		a.maxBacklog = size
+		a.Unlock()
+	}
+	return l
+}
+
+// WithSyslogFallback sets the appender that receives messages while a syslog appender's
+// connection is down. The default is stderr; nil disables the fallback. ToLocalSyslog()
+// or ToRemoteSyslog() must have been called already.
+func (l *logger) WithSyslogFallback(fallback Appender) Log5Go {
+	if a, ok := l.ownAppender().(*syslogAppender); ok {
+		a.Lock()
+		a.fallback = fallback
+		a.Unlock()
+	}
+	return l
+}
 
+// WithSyslogBackoff sets the delays between a syslog appender's reconnection attempts,
+// which double after every failed attempt from min up to max. ToLocalSyslog() or
+// ToRemoteSyslog() must have been called already.
+func (l *logger) WithSyslogBackoff(min, max time.Duration) Log5Go {
+	if a, ok := l.ownAppender().(*syslogAppender); ok {
+		a.Lock()
+		a.minBackoff = min
+		a.maxBackoff = max
+		a.Unlock()
+	}
+	return l
+}
+
+func (l *logger) WithSyslogWriteTimeout(timeout time.Duration) Log5Go {
+	if a, ok := l.ownAppender().(*syslogAppender); ok {
+		a.Lock()
+		a.timeout = timeout
+		a.Unlock()
+	}
+	return l
+}
+
+// WithSyslogHeader sets the HOSTNAME, APP-NAME, PROCID, MSGID and SD-ID of a syslog appender's
+// messages. Empty fields are left unchanged. ToLocalSyslog() or ToRemoteSyslog() must
+// have been called already.
+func (l *logger) WithSyslogHeader(header SyslogHeader) Log5Go {
+	if a, ok := l.ownAppender().(*syslogAppender); ok {
+		a.Lock()
+		if header.Hostname != "" {
+			a.header.Hostname = header.Hostname
+		}
+		if header.AppName != "" {
+			a.header.AppName = header.AppName
+		}
+		if header.ProcID != "" {
+			a.header.ProcID = header.ProcID
+		}
+		if header.MsgID != "" {
+			a.header.MsgID = header.MsgID
+		}
+		if header.SDID != "" {
+			a.header.SDID = header.SDID
+		}
+		a.Unlock()
+	}
+	return l
+}
+
+// WithSyslogProtocol selects the format of a syslog appender's messages. The default is
+// SyslogRFC5424; SyslogRFC3164 is for relays that only accept BSD syslog. ToLocalSyslog()
+// or ToRemoteSyslog() must have been called already.
+func (l *logger) WithSyslogProtocol(protocol SyslogProtocol) Log5Go {
+	if a, ok := l.ownAppender().(*syslogAppender); ok {
+		a.Lock()
+		a.protocol = protocol
+		a.Unlock()
+	}
+	return l
+}
+
+// WithSyslogFraming sets how a syslog appender delimits messages on a stream connection.
+// Remote stream transports use SyslogOctetCounting by default, which keeps multi-line
+// messages intact; SyslogNonTransparent is for receivers that expect newlines.
+// ToLocalSyslog(), ToRemoteSyslog() or ToRemoteSyslogTLS() must have been called already.
+func (l *logger) WithSyslogFraming(framing SyslogFraming) Log5Go {
+	if a, ok := l.ownAppender().(*syslogAppender); ok {
+		a.Lock()
+		a.framing = framing
+		a.Unlock()
+	}
+	return l
+}
+
+// WithSyslogSeverity sets how a syslog appender maps log levels to syslog severities.
+// SyslogSeverityTable() builds a mapping from a table; nil restores DefaultSyslogSeverity.
+// ToLocalSyslog(), ToRemoteSyslog() or ToRemoteSyslogTLS() must have been called already.
+func (l *logger) WithSyslogSeverity(severity SyslogSeverityFunc) Log5Go {
+	if a, ok := l.ownAppender().(*syslogAppender); ok {
+		a.Lock()
+		a.severity = severity
+		a.Unlock()
+	}
+	return l
+}
+
+// WithSyslogHostname selects how a syslog appender looks up the HOSTNAME of its messages,
+// unless it was set with WithSyslogHeader(). The hostname is looked up here, once; only
+// the local IP address is looked up again when the appender reconnects. ToLocalSyslog(),
+// ToRemoteSyslog() or ToRemoteSyslogTLS() must have been called already.
+func (l *logger) WithSyslogHostname(source SyslogHostname) Log5Go {
+	if a, ok := l.ownAppender().(*syslogAppender); ok {
+		hostname := lookupSyslogHostname(source)
+		a.Lock()
+		a.source = source
+		a.hostname = hostname
+		a.Unlock()
+	}
+	return l
+}
+
+// WithSyslogTime sets whether a syslog appender's timestamps are in UTC or local time,
+// and their number of fractional digits (0 to 6, the default). RFC 3164 timestamps never
+// have fractional digits. ToLocalSyslog(), ToRemoteSyslog() or ToRemoteSyslogTLS()
+// must have been called already.
+func (l *logger) WithSyslogTime(utc bool, precision int) Log5Go {
+	if a, ok := l.ownAppender().(*syslogAppender); ok {
+		a.Lock()
+		a.utc = utc
+		a.tsFormat = syslogTimeLayout(precision)
+		a.Unlock()
+	}
 	return l
 }
 
 // Add file rotation configuration to the file appender. ToFile() must have been
 // called already.
 func (l *logger) WithRotation(frequency rollFrequency, keepNLogs int) Log5Go {
-	a, isFileAppender := l.appender.(*fileAppender)
+	a, isFileAppender := l.ownAppender().(*fileAppender)
 	if !isFileAppender {
 		return l
 	}
@@ -208,12 +628,39 @@ func (l *logger) WithRotation(frequency rollFrequency, keepNLogs int) Log5Go {
 // Send WARN, ERROR, and FATAL messages to stderr. ToConsole() must have been
 // called already.
 func (l *logger) WithStderr() Log5Go {
-	a, iswriterAppender := l.appender.(*writerAppender)
+	return l.WithStderrLevel(LogWarn)
+}
+
+// WithStderrLevel sends messages at or above level to stderr. ToConsole() must have been
+// called already.
+func (l *logger) WithStderrLevel(level LogLevel) Log5Go {
+	return l.WithStderrFilter(MinLevel(level))
+}
+
+// WithStderrFilter sends messages accepted by all of filters to stderr. ToConsole() must
+// have been called already.
+func (l *logger) WithStderrFilter(filters ...Filter) Log5Go {
+	a, iswriterAppender := l.ownAppender().(*writerAppender)
 	if !iswriterAppender {
 		return l
 	}
 
 	a.errDest = os.Stderr
+	a.errFilter = AllOf(filters...)
+	a.color = a.color && supportsColor(os.Stderr)
+	return l
+}
+
+// WithColor colors console output by log level, using DefaultColorPalette. Colors are
+// only used when writing to a terminal and NO_COLOR is not set. They are never used
+// for files, syslog or custom appenders.
+func (l *logger) WithColor() Log5Go {
+	return l.WithColorPalette(DefaultColorPalette)
+}
+
+// WithColorPalette colors console output by log level, using a custom palette. See WithColor().
+func (l *logger) WithColorPalette(palette ColorPalette) Log5Go {
+	l.palette = palette
 	return l
 }
 
@@ -221,6 +668,7 @@ func (l *logger) WithFmt(format string) Log5Go {
 	stringFormatter := NewStringFormatter(format)
 	stringFormatter.explicitFormat = true
 	l.formatter = stringFormatter
+	l.sharedFmt.Store(false)
 	l.formatter.SetTimeFormat(l.timeFormat)
 	l.formatter.SetLines(l.lines != 0)
 	return l
@@ -237,10 +685,11 @@ func (l *logger) Register(key string) Log5Go {
 // format for the current config. logger should be locked by the caller so that
 // config remains unchained when the data is rendered for the returned format.
 func (l *logger) updateFormatterIfNecessary() {
+	l.ownFormatter()
 	stringFormatter, ok := l.formatter.(*StringFormatter)
 	if ok && !stringFormatter.explicitFormat {
 		pattern := getFormatForSettings(l.prefix, l.timeFormat, l.lines != 0)
-		stringFormatter.parts = decodePattern(pattern)
+		stringFormatter.setPattern(pattern)
 	}
 
 	l.formatter.SetTimeFormat(l.timeFormat)
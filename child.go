@@ -0,0 +1,155 @@
+package log5go
+
+import "fmt"
+
+// With returns a child logger that adds fields to every message it logs. fields are
+// key/value pairs (e.g. With("user", id, "request", rid)) or Data maps. The child
+// shares its parent's formatter and appenders, but its fields are immutable and its
+// prefix and level can be changed without affecting the parent, so a child can be
+// handed to other goroutines safely. Appender settings (WithStderr, WithRotation,
+// WithSyslog..., WithLoki... etc) are ignored on a child unless it is given its own
+// appender.
+func (l *logger) With(fields ...interface{}) Log5Go {
+	return l.child(l.fields, fields)
+}
+
+// child returns a child logger with fields added to base
+func (l *logger) child(base Data, fields []interface{}) *logger {
+	c := &logger{
+		level:      l.level,
+		formatter:  l.formatter,
+		appender:   l.appender,
+		sharedApp:  true,
+		timeFormat: l.timeFormat,
+		prefix:     l.prefix,
+		lines:      l.lines,
+		created:    l.created,
+		stacks:     l.stacks,
+		stackLevel: l.stackLevel,
+		palette:    l.palette,
+		hooks:      l.hooks[:len(l.hooks):len(l.hooks)], // appending to the child's hooks copies them
+		redactor:   l.redactor,
+		appenders:  l.appenders[:len(l.appenders):len(l.appenders)],
+		root:       l.rootLogger(),
+	}
+
+	merged := make(Data, len(base)+len(fields)/2)
+	for key, value := range base {
+		merged[key] = value
+	}
+	for i := 0; i < len(fields); i++ {
+		switch field := fields[i].(type) {
+		case Data:
+			for key, value := range field {
+				merged[key] = value
+			}
+		case map[string]interface{}:
+			for key, value := range field {
+				merged[key] = value
+			}
+		default:
+			key, ok := field.(string)
+			if !ok {
+				key = fmt.Sprint(field)
+			}
+			var value interface{}
+			if i+1 < len(fields) {
+				i++
+				value = fields[i]
+			}
+			merged[key] = value
+		}
+	}
+	c.fields = scrubData(merged)
+
+	// the formatter is shared until either logger reconfigures it
+	c.sharedFmt.Store(true)
+	l.sharedFmt.Store(true)
+	return c
+}
+
+// rootLogger returns the logger at the top of l's family of child loggers
+func (l *logger) rootLogger() *logger {
+	if l.root != nil {
+		return l.root
+	}
+	return l
+}
+
+// ownFormatter gives a logger its own copy of a formatter it shares with a parent,
+// child or clone before the formatter is reconfigured
+func (l *logger) ownFormatter() {
+	if !l.sharedFmt.Load() {
+		return
+	}
+	l.formatter = copyFormatter(l.formatter)
+	l.sharedFmt.Store(false)
+}
+
+// setAppender replaces l's appender with one l owns
+func (l *logger) setAppender(a Appender) {
+	l.appender = a
+	l.sharedApp = false
+}
+
+// ownAppender returns l's appender for reconfiguring, or nil if l is a child logger or
+// clone still using the appender of the logger it was made from. Appender settings are
+// ignored on such loggers, as they would change the other logger's appender too.
+func (l *logger) ownAppender() Appender {
+	if l.sharedApp {
+		return nil
+	}
+	return l.appender
+}
+
+// copyFormatter returns a copy of f that can be configured independently. Custom
+// formatters can't be copied and are returned as is.
+func copyFormatter(f Formatter) Formatter {
+	switch f := f.(type) {
+	case *StringFormatter:
+		c := *f
+		return &c
+	case *jsonFormatter:
+		c := *f
+		return &c
+	case *syslogFormatter:
+		inner, noPrefix := *f.formatter, *f.noPrefix
+		return &syslogFormatter{formatter: &inner, noPrefix: &noPrefix}
+	case *recordFormatter:
+		inner, noPrefix := *f.formatter, *f.noPrefix
+		return &recordFormatter{syslogFormatter{formatter: &inner, noPrefix: &noPrefix}}
+	case *journaldFormatter:
+		inner, noPrefix := *f.formatter, *f.noPrefix
+		return &journaldFormatter{syslogFormatter{formatter: &inner, noPrefix: &noPrefix}}
+	case *lokiFormatter:
+		inner, noPrefix := *f.formatter, *f.noPrefix
+		return &lokiFormatter{syslogFormatter{formatter: &inner, noPrefix: &noPrefix}, f.labels}
+	}
+	return f
+}
+
+// withFields merges data logged with a message into the logger's fields. The logger's
+// fields are never modified.
+func (l *logger) withFields(data Data) Data {
+	if len(l.fields) == 0 {
+		return data
+	}
+	if len(data) == 0 {
+		return l.fields
+	}
+
+	merged := make(Data, len(l.fields)+len(data))
+	for key, value := range l.fields {
+		merged[key] = value
+	}
+	for key, value := range data {
+		merged[key] = value
+	}
+	return merged
+}
+
+//-- child loggers from bound loggers ------------
+
+func (l *boundLogger) With(fields ...interface{}) Log5Go {
+	return l.l.child(l.l.withFields(l.data), fields)
+}
@@ -0,0 +1,161 @@
+package log5go
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithFields(t *testing.T) {
+	var buf bytes.Buffer
+	parent := Logger(LogAll).ToWriter(&buf).WithFmt("%m")
+
+	child := parent.With("request", "r1", Data{"user": "bob"}, "odd")
+	child.Info("hello")
+	child.WithData(Data{"user": "alice", "n": 1}).Info("override")
+	parent.Info("parent")
+
+	assert.Equal(t, "hello odd=<nil> request=\"r1\" user=\"bob\"\n"+
+		"override n=1 odd=<nil> request=\"r1\" user=\"alice\"\n"+
+		"parent\n", buf.String())
+}
+
+func TestChildFieldsAreImmutable(t *testing.T) {
+	var buf bytes.Buffer
+	d := Data{"a": 1}
+	parent := Logger(LogAll).ToWriter(&buf).WithFmt("%m")
+	child := parent.With(d)
+	grandchild := child.With("b", 2)
+
+	d["a"] = 100
+	child.WithData(Data{"c": 3}).Info("child")
+	grandchild.Info("grandchild")
+
+	assert.Equal(t, "child a=1 c=3\ngrandchild a=1 b=2\n", buf.String())
+	assert.Equal(t, Data{"a": 1}, child.(*logger).fields)
+}
+
+func TestChildOverrides(t *testing.T) {
+	var buf bytes.Buffer
+	parent := Logger(LogInfo).ToWriter(&buf).WithTimeFmt("").WithPrefix("app")
+
+	child := parent.With("id", 7).WithPrefix("worker")
+	child.SetLogLevel(LogDebug)
+
+	parent.Debug("hidden")
+	child.Debug("visible")
+	parent.Info("parent")
+
+	assert.Equal(t, "DEBUG worker: visible id=7\nINFO app: parent\n", buf.String())
+	assert.Equal(t, LogInfo, parent.LogLevel())
+}
+
+func TestChildSharesAppenderAndFormatter(t *testing.T) {
+	parent := Logger(LogAll).ToStdout().Json().(*logger)
+	child := parent.With("k", "v").(*logger)
+
+	assert.True(t, parent.appender == child.appender)
+	assert.True(t, parent.formatter == child.formatter)
+
+	child.WithLongLines()
+	assert.False(t, parent.formatter == child.formatter, "child's formatter change affected parent")
+	assert.False(t, parent.formatter.(*jsonFormatter).lines)
+	assert.True(t, child.formatter.(*jsonFormatter).lines)
+}
+
+func TestParentReconfiguredAfterWith(t *testing.T) {
+	var buf bytes.Buffer
+	parent := Logger(LogAll).ToWriter(&buf).WithTimeFmt("").WithPrefix("app")
+	child := parent.With("id", 7)
+
+	parent.WithPrefix("other").WithLongLines()
+	child.Info("child")
+	assert.Equal(t, "INFO app: child id=7\n", buf.String())
+	assert.False(t, parent.(*logger).formatter == child.(*logger).formatter)
+}
+
+func TestCloneDoesNotShareFormatter(t *testing.T) {
+	var buf bytes.Buffer
+	original := Logger(LogAll).ToWriter(&buf).WithTimeFmt("").WithPrefix("app")
+	clone := original.Clone().WithPrefix("clone").WithTimeFmt("2006").WithLongLines()
+
+	original.Info("original")
+	assert.Equal(t, "INFO app: original\n", buf.String())
+	assert.False(t, original.(*logger).formatter == clone.(*logger).formatter)
+
+	// and the other way round
+	clone = original.Clone()
+	original.WithPrefix("changed")
+	buf.Reset()
+	clone.Info("clone")
+	assert.Equal(t, "INFO app: clone\n", buf.String())
+}
+
+func TestChildAppenderSettingsDontChangeParent(t *testing.T) {
+	var buf bytes.Buffer
+	parent := Logger(LogAll).ToWriter(&buf)
+	parent.With("k", "v").WithStderr()
+	parent.Clone().WithStderrFilter(MinLevel(LogInfo))
+	assert.Nil(t, parent.(*logger).appender.(*writerAppender).errDest)
+
+	loki := Logger(LogAll).ToLoki("http://localhost:3100")
+	loki.With("k", "v").WithLokiLabels("k").WithLokiBatch(10, time.Millisecond).WithLokiCompression(true)
+	a := loki.(*logger).appender.(*lokiAppender)
+	assert.Nil(t, a.labels)
+	assert.Equal(t, DefaultLokiBatchBytes, a.batchBytes)
+	assert.False(t, a.compress)
+
+	// a child given its own appender can configure it
+	child := parent.With("k", "v").ToStdout().WithStderr()
+	assert.NotNil(t, child.(*logger).appender.(*writerAppender).errDest)
+}
+
+func TestChildHooksDontLeakToParent(t *testing.T) {
+	parent := Logger(LogAll).
+		WithHook(HookFunc(func(e *Entry) bool { return true })).
+		WithHook(HookFunc(func(e *Entry) bool { return true })).(*logger)
+	parent.hooks = parent.hooks[:1] // leave spare capacity
+	child := parent.With().WithHook(HookFunc(func(e *Entry) bool { return false })).(*logger)
+
+	assert.Len(t, child.hooks, 2)
+	parent.WithHook(HookFunc(func(e *Entry) bool { return true }))
+	assert.Len(t, child.hooks, 2)
+	assert.NotNil(t, child.hooks[1])
+	var buf bytes.Buffer
+	child.ToWriter(&buf).Info("dropped")
+	assert.Equal(t, "", buf.String(), "parent's hook replaced the child's")
+}
+
+func TestChildLoggersConcurrent(t *testing.T) {
+	a := &checkingAppender{t: t}
+	parent := Logger(LogAll).ToAppender(a).WithFmt("%m")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			child := parent.With("worker", i)
+			for j := 0; j < 20; j++ {
+				child.With("j", j).WithData(Data{"k": j}).Info("work")
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, int32(160), a.count)
+}
+
+func TestBoundLoggerWithDataCopies(t *testing.T) {
+	var buf bytes.Buffer
+	bl := Logger(LogAll).ToWriter(&buf).WithFmt("%m").WithData(Data{"a": 1})
+	bl.WithData(Data{"b": 2})
+	bl.Info("bound")
+	bl.With("c", 3).Info("child")
+
+	assert.Equal(t, "bound a=1\nchild a=1 c=3\n", buf.String())
+	assert.False(t, strings.Contains(buf.String(), "b=2"))
+}
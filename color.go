@@ -0,0 +1,119 @@
+package log5go
+
+import (
+	"io"
+	"os"
+	"strings"
+)
+
+// Color is an ANSI SGR parameter string, e.g. "31" for red or "1;31" for bold red.
+type Color string
+
+// Common colors and styles
+const (
+	ColorNone        Color = ""
+	ColorReset       Color = "0"
+	ColorBold        Color = "1"
+	ColorFaint       Color = "2"
+	ColorBlack       Color = "30"
+	ColorRed         Color = "31"
+	ColorGreen       Color = "32"
+	ColorYellow      Color = "33"
+	ColorBlue        Color = "34"
+	ColorMagenta     Color = "35"
+	ColorCyan        Color = "36"
+	ColorWhite       Color = "37"
+	ColorGray        Color = "90"
+	ColorBoldRed     Color = "1;31"
+	ColorBoldMagenta Color = "1;35"
+)
+
+// names usable in %[name] color spans of StringFormatter patterns
+var colorNames = map[string]Color{
+	"":        ColorReset,
+	"reset":   ColorReset,
+	"bold":    ColorBold,
+	"faint":   ColorFaint,
+	"black":   ColorBlack,
+	"red":     ColorRed,
+	"green":   ColorGreen,
+	"yellow":  ColorYellow,
+	"blue":    ColorBlue,
+	"magenta": ColorMagenta,
+	"cyan":    ColorCyan,
+	"white":   ColorWhite,
+	"gray":    ColorGray,
+}
+
+// ColorPalette maps log levels to colors. A level without an entry of its own
+// (e.g. a custom level) uses the color of the closest level below it.
+type ColorPalette map[LogLevel]Color
+
+// DefaultColorPalette is used by WithColor()
+var DefaultColorPalette = ColorPalette{
+	LogTrace:    ColorGray,
+	LogDebug:    ColorGray,
+	LogInfo:     ColorNone,
+	LogNotice:   ColorCyan,
+	LogWarn:     ColorYellow,
+	LogError:    ColorRed,
+	LogCritical: ColorBoldRed,
+	LogAlert:    ColorBoldRed,
+	LogFatal:    ColorBoldMagenta,
+}
+
+// ColorFor returns the color for level. A custom level without an entry in the
+// palette uses its own color if it was created with LevelColor.
+func (p ColorPalette) ColorFor(level LogLevel) Color {
+	if c, ok := p[level]; ok {
+		return c
+	}
+	if c, ok := levelColor(level); ok {
+		return c
+	}
+
+	var closest LogLevel
+	var found bool
+	for l := range p {
+		if l < level && (!found || l > closest) {
+			closest = l
+			found = true
+		}
+	}
+	return p[closest]
+}
+
+// parseColor resolves a %[name] span name to a color. Besides the names in colorNames,
+// "level" (the entry's level color) and raw SGR parameters like "1;35" are accepted.
+func parseColor(name string) (c Color, ok bool) {
+	if name == "level" {
+		return "", true
+	}
+	if c, ok = colorNames[name]; ok {
+		return c, true
+	}
+	if strings.Trim(name, "0123456789;") == "" {
+		return Color(name), true
+	}
+	return "", false
+}
+
+func appendColor(buf *[]byte, c Color) {
+	*buf = append(*buf, "\x1b["...)
+	*buf = append(*buf, c...)
+	*buf = append(*buf, 'm')
+}
+
+// supportsColor returns true iff w is a terminal and the user hasn't opted out
+// of colors by setting NO_COLOR (see https://no-color.org)
+func supportsColor(w io.Writer) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,78 @@
+package log5go
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ColorForCustomLevels(t *testing.T) {
+	p := ColorPalette{LogInfo: ColorGreen, LogWarn: ColorYellow}
+
+	assert.Equal(t, ColorGreen, p.ColorFor(LogInfo))
+	assert.Equal(t, ColorGreen, p.ColorFor(LogInfo+1))
+	assert.Equal(t, ColorYellow, p.ColorFor(LogFatal))
+	assert.Equal(t, ColorNone, p.ColorFor(LogTrace))
+
+	p[LogInfo+1] = ColorBlue
+	assert.Equal(t, ColorBlue, p.ColorFor(LogInfo+1))
+}
+
+func Test_parseColor(t *testing.T) {
+	c, ok := parseColor("red")
+	assert.True(t, ok)
+	assert.Equal(t, ColorRed, c)
+
+	c, ok = parseColor("1;35")
+	assert.True(t, ok)
+	assert.Equal(t, Color("1;35"), c)
+
+	c, ok = parseColor("")
+	assert.True(t, ok)
+	assert.Equal(t, ColorReset, c)
+
+	_, ok = parseColor("level")
+	assert.True(t, ok)
+
+	_, ok = parseColor("chartreuse")
+	assert.False(t, ok)
+}
+
+func Test_ColorLinesByLevel(t *testing.T) {
+	var buf bytes.Buffer
+	l := Logger(LogAll).ToAppender(&writerAppender{dest: &buf, color: true}).WithFmt("%l %m").WithColor()
+
+	l.Info("plain")
+	l.Error("red")
+	assert.Equal(t, "INFO plain\n\x1b[31mERROR red\x1b[0m\n", buf.String())
+}
+
+func Test_ColorSpans(t *testing.T) {
+	var buf bytes.Buffer
+	l := Logger(LogAll).ToAppender(&writerAppender{dest: &buf, color: true}).WithFmt("%[level]%-5l%[] %[bold]%m").WithColor()
+
+	l.Warn("careful")
+	assert.Equal(t, "\x1b[33mWARN \x1b[0m \x1b[1mcareful\x1b[0m\n", buf.String())
+
+	sf := NewStringFormatter("%[red]x%[chartreuse]%[oops")
+	assert.Equal(t, []string{"%[red]", "x[chartreuse][oops"}, partStrings(sf.parts))
+}
+
+func Test_NoColorUnlessSupported(t *testing.T) {
+	var buf bytes.Buffer
+
+	// not a terminal
+	l := Logger(LogAll).ToWriter(&buf).WithFmt("%[red]%l %m").WithColor()
+	l.Error("no color")
+	assert.Equal(t, "ERROR no color\n", buf.String())
+
+	// file appenders never get colors
+	l = Logger(LogAll).ToFile("/tmp", "color.log").WithColor()
+	assert.False(t, colorEnabled(l.(*logger).appender))
+
+	os.Setenv("NO_COLOR", "1")
+	defer os.Unsetenv("NO_COLOR")
+	assert.False(t, supportsColor(os.Stdout))
+}
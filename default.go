@@ -112,14 +112,7 @@ func parseLogLineLength(token string) (str string) {
 }
 
 func parseLogLevel(logLevelStr string) (level LogLevel) {
-	for k, v := range levelMap {
-		if v == logLevelStr {
-			level = k
-			return
-		}
-	}
-
-	level = LogAll
+	level, _ = ParseLevel(logLevelStr)
 	return
 }
 
@@ -0,0 +1,24 @@
+package log5go
+
+import "time"
+
+// Entry holds everything known about a single logging event. The logger fills
+// in an Entry for each message that passes its threshold and hands it to the
+// configured Formatter.
+type Entry struct {
+	Time   time.Time // time the message was logged
+	Level  LogLevel  // level the message was logged at
+	Prefix string    // logger prefix, if any
+	Caller string    // caller's file (if line info present)
+	Line   uint      // caller's line number (if line info present)
+	Msg    string    // caller-supplied message, already formatted
+	Data   Data      // caller-supplied structured data
+	Stack  []uintptr // caller's stack (see WithStackTrace), nil if not captured
+
+	// The following are only filled in if the formatter asks for them
+	Func      string        // caller's function name
+	Goroutine uint64        // ID of the logging goroutine
+	Elapsed   time.Duration // time since the logger was created
+
+	palette ColorPalette // level colors, nil if output should not be colored
+}
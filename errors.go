@@ -0,0 +1,116 @@
+package log5go
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+)
+
+// ErrorKey is the Data key used by Err(). An error stored under this key is
+// rendered with its full chain of wrapped errors and its stack trace (if it has one).
+const ErrorKey = "error"
+
+// maximum number of stack frames captured by WithStackTrace
+const maxStackDepth = 64
+
+// StackTracer is implemented by errors that record the stack at the point where
+// they were created. StackTrace returns program counters as captured by runtime.Callers.
+type StackTracer interface {
+	StackTrace() []uintptr
+}
+
+// Err returns a Data map holding err under ErrorKey, for use with WithData:
+//
+//	log.WithData(log5go.Err(err)).Error("unable to save user %d", id)
+func Err(err error) Data {
+	return Data{ErrorKey: err}
+}
+
+// entryError finds the error that should be rendered in detail for a log message.
+// An error stored under ErrorKey wins; otherwise the error with the lowest key is used.
+func entryError(data Data) (key string, err error) {
+	if e, ok := data[ErrorKey].(error); ok {
+		return ErrorKey, e
+	}
+
+	var keys []string
+	for k, v := range data {
+		if _, ok := v.(error); ok {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return "", nil
+	}
+	sort.Strings(keys)
+	return keys[0], data[keys[0]].(error)
+}
+
+// errorChain returns the messages of err and every error it wraps, depth first.
+// Both errors.Unwrap-style and errors.Join-style wrapping are followed.
+func errorChain(err error) (chain []string) {
+	walkErrors(err, func(e error) {
+		chain = append(chain, e.Error())
+	})
+	return chain
+}
+
+// errorStack returns the stack of the innermost error in err's chain that
+// implements StackTracer and has a stack, or nil if none does.
+func errorStack(err error) (stack []uintptr) {
+	walkErrors(err, func(e error) {
+		if st, ok := e.(StackTracer); ok && st.StackTrace() != nil {
+			stack = st.StackTrace()
+		}
+	})
+	return stack
+}
+
+func walkErrors(err error, visit func(error)) {
+	if err == nil {
+		return
+	}
+	visit(err)
+
+	switch e := err.(type) {
+	case interface{ Unwrap() error }:
+		walkErrors(e.Unwrap(), visit)
+	case interface{ Unwrap() []error }:
+		for _, inner := range e.Unwrap() {
+			walkErrors(inner, visit)
+		}
+	}
+}
+
+// callers captures the stack above the frame skip levels up from the caller of callers,
+// using the same convention as runtime.Caller.
+func callers(skip int) []uintptr {
+	pcs := make([]uintptr, maxStackDepth)
+	n := runtime.Callers(skip+2, pcs)
+	return pcs[:n]
+}
+
+// stackFrames renders program counters as "function (file:line)" strings
+func stackFrames(pcs []uintptr) (result []string) {
+	if len(pcs) == 0 {
+		return nil
+	}
+	frames := runtime.CallersFrames(pcs)
+	for {
+		frame, more := frames.Next()
+		result = append(result, fmt.Sprintf("%s (%s:%d)", frame.Function, frame.File, frame.Line))
+		if !more {
+			break
+		}
+	}
+	return result
+}
+
+// entryStack returns the stack to render for an entry: the stack of its error if
+// the error carries one, otherwise the caller's stack (if captured).
+func entryStack(e *Entry, err error) []uintptr {
+	if stack := errorStack(err); stack != nil {
+		return stack
+	}
+	return e.Stack
+}
@@ -0,0 +1,118 @@
+package log5go
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type stackError struct {
+	msg   string
+	stack []uintptr
+}
+
+func (e *stackError) Error() string         { return e.msg }
+func (e *stackError) StackTrace() []uintptr { return e.stack }
+
+func newStackError(msg string) error {
+	return &stackError{msg: msg, stack: callers(0)}
+}
+
+func Test_errorChain(t *testing.T) {
+	root := errors.New("connection refused")
+	wrapped := fmt.Errorf("saving user: %w", root)
+	joined := errors.Join(wrapped, errors.New("rollback failed"))
+
+	assert.Equal(t, []string{"connection refused"}, errorChain(root))
+	assert.Equal(t, []string{"saving user: connection refused", "connection refused"}, errorChain(wrapped))
+	assert.Equal(t, []string{joined.Error(), "saving user: connection refused", "connection refused", "rollback failed"}, errorChain(joined))
+	assert.Nil(t, errorChain(nil))
+}
+
+func Test_errorStack(t *testing.T) {
+	assert.Nil(t, errorStack(errors.New("no stack")))
+
+	inner := newStackError("inner")
+	outer := &stackError{msg: "outer", stack: []uintptr{1}}
+	wrapped := fmt.Errorf("wrapped: %w", inner)
+	assert.Equal(t, inner.(*stackError).stack, errorStack(wrapped))
+	assert.Equal(t, []uintptr{1}, errorStack(outer))
+}
+
+func Test_entryError(t *testing.T) {
+	e1 := errors.New("one")
+	e2 := errors.New("two")
+
+	key, err := entryError(Data{"b": e2, "a": e1, ErrorKey: e2, "foo": "bar"})
+	assert.Equal(t, ErrorKey, key)
+	assert.Equal(t, e2, err)
+
+	key, err = entryError(Data{"b": e2, "a": e1})
+	assert.Equal(t, "a", key)
+	assert.Equal(t, e1, err)
+
+	key, err = entryError(Data{"foo": "bar"})
+	assert.Equal(t, "", key)
+	assert.Nil(t, err)
+}
+
+func Test_ScrubDataKeepsErrors(t *testing.T) {
+	err := fmt.Errorf("boom")
+	d := scrubData(Data{"err": err, "strct": struct{}{}})
+	assert.Equal(t, map[string]interface{}{"err": err}, d)
+}
+
+func Test_JsonFormatterRendersErrors(t *testing.T) {
+	var buf []byte
+	err := fmt.Errorf("saving user: %w", newStackError("connection refused"))
+	f := &jsonFormatter{timeFormat: TF_GoStd}
+
+	d := Err(err)
+	d["other"] = errors.New("other")
+	f.FormatEntry(&Entry{Time: time.Now(), Level: LogError, Msg: "failed", Data: d}, &buf)
+
+	var out map[string]interface{}
+	assert.Nil(t, json.Unmarshal(buf, &out))
+	assert.Equal(t, "saving user: connection refused", out["error"])
+	assert.Equal(t, []interface{}{"saving user: connection refused", "connection refused"}, out["error_chain"])
+	assert.Equal(t, map[string]interface{}{"other": "other"}, out["data"])
+	stack, _ := out["stacktrace"].([]interface{})
+	if assert.NotEmpty(t, stack) {
+		assert.Contains(t, stack[0], "newStackError")
+	}
+}
+
+func Test_StringFormatterRendersErrorBlock(t *testing.T) {
+	var buf []byte
+	err := fmt.Errorf("saving user: %w", errors.New("connection refused"))
+	sf := NewStringFormatter("%l: %m")
+
+	sf.FormatEntry(&Entry{Level: LogError, Msg: "failed", Data: Data{"id": 7, "err": err}}, &buf)
+	expected := "ERROR: failed id=7\n\terror: saving user: connection refused\n\tcaused by: connection refused"
+	assert.Equal(t, expected, string(buf))
+}
+
+func Test_WithStackTrace(t *testing.T) {
+	var buf bytes.Buffer
+	log := Logger(LogAll).ToWriter(&buf).WithFmt("%l %m").WithStackTrace(LogError)
+
+	log.Warn("no stack")
+	assert.Equal(t, "WARN no stack\n", buf.String())
+
+	buf.Reset()
+	log.Error("stack")
+	lines := strings.Split(buf.String(), "\n")
+	assert.Equal(t, "ERROR stack", lines[0])
+	assert.Equal(t, "\tstacktrace:", lines[1])
+
+	pc, _, _, _ := runtime.Caller(0)
+	fn := runtime.FuncForPC(pc).Name()
+	assert.True(t, strings.HasPrefix(lines[2], "\t\t"+fn+" "), "expected first frame in %s but got %s", fn, lines[2])
+}
@@ -43,6 +43,10 @@ func (a *fileAppender) Append(msg *[]byte, level LogLevel, tstamp time.Time) err
 	return err
 }
 
+func (a *fileAppender) Concurrent() bool {
+	return true
+}
+
 // Determine whether we should roll the log file. Must be in lock already.
 func (a *fileAppender) shouldRoll(tstamp time.Time) bool {
 	if a.rollFrequency == RollNone {
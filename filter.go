@@ -0,0 +1,145 @@
+package log5go
+
+import (
+	"strings"
+	"time"
+)
+
+// Filter decides whether an entry is sent to an appender. Filters are attached to
+// appenders with Filtered() and combined with AllOf(), AnyOf() and Not().
+type Filter func(e Entry) bool
+
+// MinLevel accepts entries at or above level
+func MinLevel(level LogLevel) Filter {
+	return func(e Entry) bool {
+		return e.Level >= level
+	}
+}
+
+// MaxLevel accepts entries at or below level
+func MaxLevel(level LogLevel) Filter {
+	return func(e Entry) bool {
+		return e.Level <= level
+	}
+}
+
+// LevelRange accepts entries from min to max, inclusive
+func LevelRange(min, max LogLevel) Filter {
+	return func(e Entry) bool {
+		return e.Level >= min && e.Level <= max
+	}
+}
+
+// Levels accepts entries at exactly one of the given levels
+func Levels(levels ...LogLevel) Filter {
+	return func(e Entry) bool {
+		for _, level := range levels {
+			if e.Level == level {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// HasPrefix accepts entries whose logger prefix starts with prefix
+func HasPrefix(prefix string) Filter {
+	return func(e Entry) bool {
+		return strings.HasPrefix(e.Prefix, prefix)
+	}
+}
+
+// HasData accepts entries whose data contains key and, if pred isn't nil, whose
+// value for key satisfies pred
+func HasData(key string, pred func(value interface{}) bool) Filter {
+	return func(e Entry) bool {
+		value, ok := e.Data[key]
+		return ok && (pred == nil || pred(value))
+	}
+}
+
+// Not accepts entries that f rejects
+func Not(f Filter) Filter {
+	return func(e Entry) bool {
+		return !f(e)
+	}
+}
+
+// AllOf accepts entries that all of filters accept
+func AllOf(filters ...Filter) Filter {
+	if len(filters) == 1 {
+		return filters[0]
+	}
+	return func(e Entry) bool {
+		for _, f := range filters {
+			if !f(e) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// AnyOf accepts entries that at least one of filters accepts
+func AnyOf(filters ...Filter) Filter {
+	return func(e Entry) bool {
+		for _, f := range filters {
+			if f(e) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// filteredAppender only receives entries accepted by its filter
+type filteredAppender struct {
+	appender Appender
+	filter   Filter
+}
+
+// Filtered returns an appender that only appends messages whose entries are accepted
+// by all of filters. Use it with ToAppender() or WithAppender().
+func Filtered(a Appender, filters ...Filter) Appender {
+	return &filteredAppender{appender: a, filter: AllOf(filters...)}
+}
+
+func (a *filteredAppender) Append(msg *[]byte, level LogLevel, tstamp time.Time) error {
+	return a.appender.Append(msg, level, tstamp)
+}
+
+func (a *filteredAppender) Concurrent() bool {
+	ca, ok := a.appender.(ConcurrentAppender)
+	return ok && ca.Concurrent()
+}
+
+func (a *filteredAppender) Flush(timeout time.Duration) error {
+	if f, ok := a.appender.(Flusher); ok {
+		return f.Flush(timeout)
+	}
+	return nil
+}
+
+func (a *filteredAppender) appendEntry(msg *[]byte, e *Entry) error {
+	return appendEntry(a.appender, msg, e)
+}
+
+// accepts returns true iff appender a should receive entry e
+func accepts(a Appender, e *Entry) bool {
+	fa, ok := a.(*filteredAppender)
+	return !ok || fa.filter == nil || fa.filter(*e)
+}
+
+// entryAppender is implemented by appenders that need the whole entry, not just its
+// level and time, to decide where a message goes
+type entryAppender interface {
+	appendEntry(msg *[]byte, e *Entry) error
+}
+
+// appendEntry appends msg to a, giving it the entry if it can use it
+func appendEntry(a Appender, msg *[]byte, e *Entry) error {
+	if ea, ok := a.(entryAppender); ok {
+		return ea.appendEntry(msg, e)
+	}
+	return a.Append(msg, e.Level, e.Time)
+}
@@ -0,0 +1,130 @@
+package log5go
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilters(t *testing.T) {
+	e := Entry{Level: LogWarn, Prefix: "db.pool", Data: Data{"user": "bob", "attempt": 3}}
+
+	var tests = []struct {
+		name     string
+		filter   Filter
+		expected bool
+	}{
+		{"min level below", MinLevel(LogInfo), true},
+		{"min level above", MinLevel(LogError), false},
+		{"max level", MaxLevel(LogWarn), true},
+		{"max level below", MaxLevel(LogInfo), false},
+		{"range", LevelRange(LogInfo, LogError), true},
+		{"range outside", LevelRange(LogError, LogFatal), false},
+		{"levels", Levels(LogInfo, LogWarn), true},
+		{"levels missing", Levels(LogInfo, LogError), false},
+		{"prefix", HasPrefix("db."), true},
+		{"prefix mismatch", HasPrefix("http"), false},
+		{"data key", HasData("user", nil), true},
+		{"data key missing", HasData("host", nil), false},
+		{"data predicate", HasData("attempt", func(v interface{}) bool { return v.(int) > 2 }), true},
+		{"data predicate fails", HasData("attempt", func(v interface{}) bool { return v.(int) > 5 }), false},
+		{"not", Not(MinLevel(LogError)), true},
+		{"all", AllOf(MinLevel(LogInfo), HasPrefix("db")), true},
+		{"all fails", AllOf(MinLevel(LogInfo), HasPrefix("http")), false},
+		{"any", AnyOf(MinLevel(LogError), HasPrefix("db")), true},
+		{"any fails", AnyOf(MinLevel(LogError), HasPrefix("http")), false},
+		{"custom", func(e Entry) bool { return e.Level == LogWarn }, true},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, test.filter(e), test.name)
+	}
+}
+
+func TestFilteredAppenders(t *testing.T) {
+	const logAudit LogLevel = 450
+
+	var app, audit bytes.Buffer
+	l := Logger(LogAll).WithFmt("%m").
+		ToAppender(Filtered(NewWriterAppender(&app), Not(Levels(logAudit)))).
+		WithAppender(Filtered(NewWriterAppender(&audit), Levels(logAudit)))
+
+	l.Info("started")
+	l.Log(logAudit, "user bob logged in")
+	l.Error("failed")
+
+	assert.Equal(t, "started\nfailed\n", app.String())
+	assert.Equal(t, "user bob logged in\n", audit.String())
+}
+
+func TestMultipleAppendersGetSameMessage(t *testing.T) {
+	var a, b bytes.Buffer
+	l := Logger(LogAll).WithFmt("%m").ToWriter(&a).WithAppender(NewWriterAppender(&b))
+
+	l.Info("one")
+	l.WithData(Data{"k": 1}).Info("two")
+	assert.Equal(t, "one\ntwo k=1\n", a.String())
+	assert.Equal(t, a.String(), b.String())
+}
+
+func TestColorsOnlyForConsoleAppenders(t *testing.T) {
+	var console, plain bytes.Buffer
+	l := Logger(LogAll).WithFmt("%m").
+		ToAppender(&writerAppender{dest: &console, color: true}).
+		WithAppender(NewWriterAppender(&plain)).
+		WithColor()
+
+	l.Error("boom")
+	assert.Equal(t, "\x1b[31mboom\x1b[0m\n", console.String())
+	assert.Equal(t, "boom\n", plain.String())
+}
+
+func TestStderrSplit(t *testing.T) {
+	var tests = []struct {
+		build    func(l Log5Go) Log5Go
+		expected string
+	}{
+		{func(l Log5Go) Log5Go { return l.WithStderr() }, "out: INFO | err: WARN ERROR"},
+		{func(l Log5Go) Log5Go { return l.WithStderrLevel(LogError) }, "out: INFO WARN | err: ERROR"},
+		{func(l Log5Go) Log5Go { return l.WithStderrFilter(Levels(LogWarn)) }, "out: INFO ERROR | err: WARN"},
+	}
+
+	for _, test := range tests {
+		var out, errOut bytes.Buffer
+		l := test.build(Logger(LogAll).ToWriter(&out).WithFmt("%l"))
+		l.(*logger).appender.(*writerAppender).errDest = &errOut
+
+		l.Info("")
+		l.Warn("")
+		l.Error("")
+
+		actual := "out: " + strings.Join(strings.Fields(out.String()), " ") + " | err: " + strings.Join(strings.Fields(errOut.String()), " ")
+		assert.Equal(t, test.expected, actual)
+	}
+}
+
+func TestNewFileAppender(t *testing.T) {
+	dir := t.TempDir()
+	a, err := NewFileAppender(dir, "audit.log")
+	assert.NoError(t, err)
+
+	l := Logger(LogAll).WithFmt("%m").ToAppender(nullAppender{}).WithAppender(a)
+	l.Info("audited")
+
+	contents, _ := os.ReadFile(filepath.Join(dir, "audit.log"))
+	assert.Equal(t, "audited\n", string(contents))
+
+	_, err = NewFileAppender(filepath.Join(dir, "missing"), "audit.log")
+	assert.Error(t, err)
+}
+
+type nullAppender struct{}
+
+func (nullAppender) Append(msg *[]byte, level LogLevel, tstamp time.Time) error {
+	return nil
+}
@@ -0,0 +1,349 @@
+package log5go
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+// Defaults for batching messages sent to Fluentd or Fluent Bit
+const (
+	DefaultFluentBatchSize     = 100         // messages sent together
+	DefaultFluentFlushInterval = time.Second // maximum time a message waits for its batch to fill
+)
+
+// Fluent forward limits
+const (
+	maxFluentBatchBytes   = 1 << 20 // a batch is sent once it holds this many bytes
+	maxFluentPendingBatch = 100     // unsent batches kept while the server is unreachable
+	maxFluentAckBytes     = 1 << 10 // longest response accepted as an ack
+)
+
+// minimum time between attempts to connect to a Fluent server that is down
+var fluentRedialInterval = time.Second
+
+// fields of a Fluent record set by the Fluent appender. Data keys with these names get a leading '_'.
+var fluentFields = map[string]bool{
+	"message": true,
+	"level":   true,
+	"prefix":  true,
+	"file":    true,
+	"line":    true,
+}
+
+// fluentBatch is a batch of messages in PackedForward mode
+type fluentBatch struct {
+	entries []byte // MessagePack stream of [time, record] entries
+	count   int    // number of entries
+	chunk   string // ID the server acknowledges, if acks are enabled
+}
+
+// fluentAppender sends messages to Fluentd or Fluent Bit using the forward protocol.
+// Messages are sent in batches, in PackedForward mode. A batch is sent when it is full,
+// when its oldest message has waited for the flush interval, or right away for messages
+// at ERROR and above. Batches are sent in their own goroutine, so logging never waits
+// for the server, and Flush must be called before the program exits. If the connection is down, batches are kept and sent when a
+// reconnection attempt succeeds; with acks, a batch is only dropped once the server
+// has acknowledged it.
+type fluentAppender struct {
+	sync.Mutex
+	conn          net.Conn
+	dial          func() (net.Conn, error)
+	tag           string
+	batch         fluentBatch   // batch being filled
+	pending       []fluentBatch // full batches not sent yet, oldest first
+	dropped       int           // messages dropped from a full pending list
+	batchSize     int
+	flushInterval time.Duration
+	ackTimeout    time.Duration // 0 if acks are disabled
+	sending       bool          // whether pending is being sent
+	idle          chan struct{} // closed when the sender stops
+	nextDial      time.Time     // time of the next connection attempt while the server is down
+	timer         *time.Timer   // flushes the batch, or retries sending it
+	msg           []byte        // buffer for the forward message being written, used by the sender
+	ack           []byte        // buffer for the server's ack, used by the sender
+}
+
+func newFluentAppender(dial func() (net.Conn, error), tag string) *fluentAppender {
+	return &fluentAppender{
+		dial:          dial,
+		tag:           tag,
+		batchSize:     DefaultFluentBatchSize,
+		flushInterval: DefaultFluentFlushInterval,
+	}
+}
+
+func (a *fluentAppender) Append(msg *[]byte, level LogLevel, tstamp time.Time) error {
+	return a.appendEntry(msg, &Entry{Level: level, Time: tstamp})
+}
+
+// appendEntry adds a [time, record] entry to the current batch, sending the batch if
+// it is full or the message is an error
+func (a *fluentAppender) appendEntry(msg *[]byte, e *Entry) error {
+	a.Lock()
+	defer a.Unlock()
+
+	a.batch.entries = appendFluentEntry(a.batch.entries, e, bytes.TrimRight(*msg, "\n"))
+	a.batch.count++
+	if a.batch.count >= a.batchSize || len(a.batch.entries) >= maxFluentBatchBytes || e.Level >= LogError {
+		a.flush()
+		return nil
+	}
+	a.scheduleFlush(a.flushInterval)
+	return nil
+}
+
+// appendFluentEntry appends [time, record] for e. The record holds the message, the
+// level's name, the prefix, the caller's file and line, and the data.
+func appendFluentEntry(buf []byte, e *Entry, msg []byte) []byte {
+	size := 2 + len(e.Data)
+	if e.Prefix != "" {
+		size++
+	}
+	if e.Caller != "" {
+		size += 2
+	}
+
+	buf = appendMsgpackArrayHeader(buf, 2)
+	buf = appendMsgpackEventTime(buf, e.Time)
+	buf = appendMsgpackMapHeader(buf, size)
+	buf = appendMsgpackString(buf, "message")
+	buf = appendMsgpackString(buf, string(msg))
+	buf = appendMsgpackString(buf, "level")
+	buf = appendMsgpackString(buf, GetLogLevelString(e.Level))
+	if e.Prefix != "" {
+		buf = appendMsgpackString(buf, "prefix")
+		buf = appendMsgpackString(buf, e.Prefix)
+	}
+	if e.Caller != "" {
+		buf = appendMsgpackString(buf, "file")
+		buf = appendMsgpackString(buf, e.Caller)
+		buf = appendMsgpackString(buf, "line")
+		buf = appendMsgpackUint(buf, uint64(e.Line))
+	}
+
+	var scratch [16]string
+	for _, key := range sortedKeys(e.Data, scratch[:0]) {
+		if fluentFields[key] {
+			buf = appendMsgpackString(buf, "_"+key)
+		} else {
+			buf = appendMsgpackString(buf, key)
+		}
+		buf = appendMsgpackValue(buf, e.Data[key])
+	}
+	return buf
+}
+
+// scheduleFlush makes sure the current batch is sent, or sending is retried, within
+// delay. Caller must hold the lock.
+func (a *fluentAppender) scheduleFlush(delay time.Duration) {
+	if a.timer == nil {
+		a.timer = time.AfterFunc(delay, a.timedFlush)
+	}
+}
+
+func (a *fluentAppender) timedFlush() {
+	a.Lock()
+	defer a.Unlock()
+
+	a.timer = nil
+	a.flush()
+}
+
+// flush queues the current batch and starts sending the pending batches, unless they
+// are already being sent or the server is down until nextDial. Caller must hold the lock.
+func (a *fluentAppender) flush() {
+	if a.timer != nil {
+		a.timer.Stop()
+		a.timer = nil
+	}
+	if a.batch.count > 0 {
+		if a.ackTimeout > 0 {
+			a.batch.chunk = newFluentChunkID()
+		}
+		a.pending = append(a.pending, a.batch)
+		a.batch = fluentBatch{}
+		a.trimPending()
+	}
+
+	if len(a.pending) == 0 || a.sending {
+		return
+	}
+	if now := time.Now(); now.Before(a.nextDial) {
+		a.scheduleFlush(a.nextDial.Sub(now))
+		return
+	}
+	a.sending = true
+	a.idle = make(chan struct{})
+	go a.sendPending()
+}
+
+// Flush queues the current batch and waits up to timeout for the pending batches to be
+// sent, retrying the connection every fluentRedialInterval if the server is down
+func (a *fluentAppender) Flush(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	a.Lock()
+	defer a.Unlock()
+
+	for {
+		a.flush()
+		if len(a.pending) == 0 && !a.sending {
+			return nil
+		}
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			return fmt.Errorf("Fluent messages are still unsent after %v", timeout)
+		}
+
+		// wait for the sender to stop, or for the next connection attempt
+		var idle chan struct{}
+		if a.sending {
+			idle = a.idle
+		} else if retry := time.Until(a.nextDial); retry < wait {
+			wait = retry
+		}
+		a.Unlock()
+		timer := time.NewTimer(wait)
+		select {
+		case <-idle:
+		case <-timer.C:
+		}
+		timer.Stop()
+		a.Lock()
+	}
+}
+
+// trimPending drops the oldest batches while there are too many pending. Caller must
+// hold the lock.
+func (a *fluentAppender) trimPending() {
+	for len(a.pending) > maxFluentPendingBatch {
+		a.dropped += a.pending[0].count
+		a.pending[0] = fluentBatch{}
+		a.pending = a.pending[1:]
+	}
+}
+
+// sendPending sends the pending batches, oldest first, until they have all been sent
+// or the connection fails, in which case the failed batch is kept and the connection
+// is retried after fluentRedialInterval. The lock is released while each batch is sent.
+func (a *fluentAppender) sendPending() {
+	a.Lock()
+	defer a.Unlock()
+
+	for len(a.pending) > 0 {
+		batch, ackTimeout := a.pending[0], a.ackTimeout
+		a.pending[0] = fluentBatch{}
+		a.pending = a.pending[1:]
+
+		a.Unlock()
+		err := a.send(&batch, ackTimeout)
+		a.Lock()
+
+		if err != nil {
+			if a.conn != nil {
+				a.conn.Close()
+				a.conn = nil
+			}
+			a.pending = append([]fluentBatch{batch}, a.pending...)
+			a.trimPending()
+			a.sending = false
+			close(a.idle)
+			a.nextDial = time.Now().Add(fluentRedialInterval)
+			a.scheduleFlush(fluentRedialInterval)
+			return
+		}
+	}
+	a.pending = nil
+	a.sending = false
+	close(a.idle)
+
+	if a.dropped > 0 {
+		reportError("%d messages were dropped while the Fluent server was unreachable", a.dropped)
+		a.dropped = 0
+	}
+}
+
+// send writes a batch as a PackedForward message, [tag, entries, options], and waits for
+// the server's ack if acks are enabled. Only the sender may call it, without the lock.
+func (a *fluentAppender) send(batch *fluentBatch, ackTimeout time.Duration) error {
+	if a.conn == nil {
+		conn, err := a.dial()
+		if err != nil {
+			return err
+		}
+		a.conn = conn
+	}
+
+	options := 1
+	if batch.chunk != "" {
+		options++
+	}
+	a.msg = appendMsgpackArrayHeader(a.msg[:0], 3)
+	a.msg = appendMsgpackString(a.msg, a.tag)
+	a.msg = appendMsgpackBin(a.msg, batch.entries)
+	a.msg = appendMsgpackMapHeader(a.msg, options)
+	a.msg = appendMsgpackString(a.msg, "size")
+	a.msg = appendMsgpackUint(a.msg, uint64(batch.count))
+	if batch.chunk != "" {
+		a.msg = appendMsgpackString(a.msg, "chunk")
+		a.msg = appendMsgpackString(a.msg, batch.chunk)
+	}
+
+	if _, err := a.conn.Write(a.msg); err != nil {
+		return err
+	}
+	if batch.chunk == "" {
+		return nil
+	}
+	return a.readAck(batch.chunk, ackTimeout)
+}
+
+// readAck waits up to timeout for the server to acknowledge a chunk with {"ack": chunk}.
+// Only the sender may call it, without the lock.
+func (a *fluentAppender) readAck(chunk string, timeout time.Duration) error {
+	a.conn.SetReadDeadline(time.Now().Add(timeout))
+	defer a.conn.SetReadDeadline(time.Time{})
+
+	a.ack = a.ack[:0]
+	buf := make([]byte, 256)
+	for {
+		n, err := a.conn.Read(buf)
+		a.ack = append(a.ack, buf[:n]...)
+		response, _, decodeErr := decodeMsgpack(a.ack)
+		if decodeErr == nil {
+			if m, ok := response.(map[string]interface{}); ok && m["ack"] == chunk {
+				return nil
+			}
+			return fmt.Errorf("unexpected response from Fluent server: %v", response)
+		}
+		if decodeErr != errMsgpackShort {
+			return decodeErr
+		}
+		if len(a.ack) > maxFluentAckBytes {
+			return fmt.Errorf("Fluent server's response is longer than %d bytes", maxFluentAckBytes)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (a *fluentAppender) Concurrent() bool {
+	return true
+}
+
+// newFluentChunkID returns a random chunk ID for the server to acknowledge
+func newFluentChunkID() string {
+	var id [16]byte
+	for i := 0; i < len(id); i += 8 {
+		u := rand.Uint64()
+		for j := 0; j < 8; j++ {
+			id[i+j] = byte(u >> (8 * j))
+		}
+	}
+	return base64.StdEncoding.EncodeToString(id[:])
+}
@@ -0,0 +1,445 @@
+package log5go
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fluentMessage is a PackedForward message as decoded by a Fluent server
+type fluentMessage struct {
+	tag     string
+	entries []fluentEntry
+	options map[string]interface{}
+}
+
+type fluentEntry struct {
+	time   time.Time
+	record map[string]interface{}
+}
+
+// fluentServer is a TCP server standing in for Fluentd. It decodes PackedForward
+// messages and, if ack is set, acknowledges their chunks.
+type fluentServer struct {
+	ln       net.Listener
+	ack      bool
+	messages chan fluentMessage
+}
+
+func listenFluent(t *testing.T, ack bool) *fluentServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip("can't listen on TCP: ", err)
+	}
+	s := &fluentServer{ln: ln, ack: ack, messages: make(chan fluentMessage, 10)}
+	go s.serve(t)
+	return s
+}
+
+func (s *fluentServer) serve(t *testing.T) {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(t, conn)
+	}
+}
+
+func (s *fluentServer) handle(t *testing.T, conn net.Conn) {
+	defer conn.Close()
+	var data []byte
+	buf := make([]byte, 4096)
+	for {
+		n, err := conn.Read(buf)
+		data = append(data, buf[:n]...)
+		for {
+			value, rest, decodeErr := decodeMsgpack(data)
+			if decodeErr == errMsgpackShort {
+				break
+			}
+			if decodeErr != nil {
+				t.Error(decodeErr)
+				return
+			}
+			data = rest
+
+			msg := decodeFluentMessage(t, value)
+			if s.ack {
+				if chunk, ok := msg.options["chunk"].(string); ok {
+					conn.Write(appendMsgpackMap(nil, Data{"ack": chunk}))
+				}
+			}
+			s.messages <- msg
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (s *fluentServer) read(t *testing.T) fluentMessage {
+	select {
+	case msg := <-s.messages:
+		return msg
+	case <-time.After(2 * time.Second):
+		t.Fatal("no message received")
+	}
+	return fluentMessage{}
+}
+
+func (s *fluentServer) Close() {
+	s.ln.Close()
+}
+
+// decodeFluentMessage decodes [tag, entries, options], where entries is a bin stream of [time, record]
+func decodeFluentMessage(t *testing.T, value interface{}) fluentMessage {
+	array, ok := value.([]interface{})
+	if !ok || len(array) != 3 {
+		t.Fatalf("not a PackedForward message: %v", value)
+	}
+	msg := fluentMessage{tag: array[0].(string), options: array[2].(map[string]interface{})}
+
+	stream := array[1].([]byte)
+	for len(stream) > 0 {
+		entry, rest, err := decodeMsgpack(stream)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stream = rest
+
+		pair := entry.([]interface{})
+		tstamp := pair[0].([]byte)
+		msg.entries = append(msg.entries, fluentEntry{
+			time:   time.Unix(int64(binary.BigEndian.Uint32(tstamp)), int64(binary.BigEndian.Uint32(tstamp[4:]))),
+			record: pair[1].(map[string]interface{}),
+		})
+	}
+	return msg
+}
+
+func TestFluentForward(t *testing.T) {
+	server := listenFluent(t, false)
+	defer server.Close()
+
+	l := Logger(LogAll).ToFluent("tcp", server.ln.Addr().String(), "app.web").WithFluentBatch(2, time.Minute).WithPrefix("web")
+	l.WithData(Data{"user": "bob", "attempt": 3, "level": "high"}).Info("login")
+	l.Warn("slow request")
+
+	msg := server.read(t)
+	assert.Equal(t, "app.web", msg.tag)
+	assert.Equal(t, uint64(2), msg.options["size"])
+	assert.NotContains(t, msg.options, "chunk")
+	if !assert.Len(t, msg.entries, 2) {
+		return
+	}
+
+	first := msg.entries[0]
+	assert.WithinDuration(t, time.Now(), first.time, 5*time.Second)
+	assert.Equal(t, "web: login", first.record["message"])
+	assert.Equal(t, "INFO", first.record["level"])
+	assert.Equal(t, "web", first.record["prefix"])
+	assert.True(t, strings.HasSuffix(first.record["file"].(string), "/fluent_test.go"), first.record["file"])
+	assert.NotZero(t, first.record["line"])
+	assert.Equal(t, "bob", first.record["user"])
+	assert.Equal(t, uint64(3), first.record["attempt"])
+	assert.Equal(t, "high", first.record["_level"])
+
+	assert.Equal(t, "web: slow request", msg.entries[1].record["message"])
+	assert.Equal(t, "WARN", msg.entries[1].record["level"])
+}
+
+func TestFluentFlushInterval(t *testing.T) {
+	server := listenFluent(t, false)
+	defer server.Close()
+
+	l := Logger(LogAll).ToFluent("tcp", server.ln.Addr().String(), "app").WithFluentBatch(100, 20*time.Millisecond)
+	l.Info("waiting")
+
+	msg := server.read(t)
+	assert.Len(t, msg.entries, 1)
+	assert.Equal(t, "waiting", msg.entries[0].record["message"])
+}
+
+func TestFluentErrorsAreSentImmediately(t *testing.T) {
+	server := listenFluent(t, false)
+	defer server.Close()
+
+	l := Logger(LogAll).ToFluent("tcp", server.ln.Addr().String(), "app").WithFluentBatch(100, time.Minute)
+	l.Info("context")
+	l.WithData(Data{"error": errors.New("disk full")}).Error("write failed")
+
+	msg := server.read(t)
+	if assert.Len(t, msg.entries, 2) {
+		assert.Equal(t, "context", msg.entries[0].record["message"])
+		assert.True(t, strings.HasPrefix(msg.entries[1].record["message"].(string), "write failed"))
+		assert.Equal(t, "disk full", msg.entries[1].record["error"])
+	}
+}
+
+func TestFluentFlush(t *testing.T) {
+	server := listenFluent(t, false)
+	defer server.Close()
+
+	l := Logger(LogAll).ToFluent("tcp", server.ln.Addr().String(), "app").WithFluentBatch(100, time.Minute)
+	a := l.(*logger).appender.(*fluentAppender)
+	l.Info("pending")
+	assert.NoError(t, l.WithData(Data{"user": "bob"}).Flush(time.Second))
+	a.Lock()
+	assert.False(t, a.sending)
+	assert.Empty(t, a.pending)
+	a.Unlock()
+	msg := server.read(t)
+	if assert.Len(t, msg.entries, 1) {
+		assert.Equal(t, "pending", msg.entries[0].record["message"])
+	}
+
+	// FATAL messages are sent before Fatal returns
+	l.Fatal("dying")
+	a.Lock()
+	assert.False(t, a.sending, "Fatal returned while the batch was being sent")
+	assert.Empty(t, a.pending)
+	a.Unlock()
+	msg = server.read(t)
+	if assert.Len(t, msg.entries, 1) {
+		assert.Equal(t, "dying", msg.entries[0].record["message"])
+	}
+}
+
+func TestFluentFlushTimesOut(t *testing.T) {
+	a := newFluentAppender(func() (net.Conn, error) {
+		return nil, errors.New("connection refused")
+	}, "app")
+	a.flushInterval = time.Minute
+	m := []byte("x")
+	a.Append(&m, LogInfo, time.Now())
+
+	start := time.Now()
+	assert.Error(t, a.Flush(50*time.Millisecond))
+	assert.WithinDuration(t, start.Add(50*time.Millisecond), time.Now(), 500*time.Millisecond)
+
+	a.Lock()
+	defer a.Unlock()
+	assert.Len(t, a.pending, 1, "unsent batch was dropped")
+	if a.timer != nil {
+		a.timer.Stop()
+	}
+}
+
+// waitFluentSender waits for a's sender to finish, and returns with a locked
+func waitFluentSender(t *testing.T, a *fluentAppender) {
+	assert.Eventually(t, func() bool {
+		a.Lock()
+		defer a.Unlock()
+		return !a.sending
+	}, 2*time.Second, time.Millisecond)
+	a.Lock()
+}
+
+func TestFluentAck(t *testing.T) {
+	server := listenFluent(t, true)
+	defer server.Close()
+
+	l := Logger(LogAll).ToFluent("tcp", server.ln.Addr().String(), "app").WithFluentBatch(1, time.Minute).WithFluentAck(time.Second)
+	l.Info("one")
+	l.Info("two")
+
+	first, second := server.read(t), server.read(t)
+	assert.NotEmpty(t, first.options["chunk"])
+	assert.NotEqual(t, first.options["chunk"], second.options["chunk"])
+
+	a := l.(*logger).appender.(*fluentAppender)
+	waitFluentSender(t, a)
+	defer a.Unlock()
+	assert.Empty(t, a.pending)
+}
+
+func TestFluentResendsUnacknowledgedBatches(t *testing.T) {
+	server := listenFluent(t, true)
+	defer server.Close()
+
+	client, silent := net.Pipe()
+	go func() {
+		// read the batch but never acknowledge it
+		buf := make([]byte, 4096)
+		silent.Read(buf)
+	}()
+
+	dials := 0
+	a := newFluentAppender(func() (net.Conn, error) {
+		dials++
+		if dials == 1 {
+			return client, nil
+		}
+		return net.Dial("tcp", server.ln.Addr().String())
+	}, "app")
+	a.ackTimeout = 50 * time.Millisecond
+	a.flushInterval = time.Minute
+
+	m := []byte("lost")
+	assert.NoError(t, a.appendEntry(&m, &Entry{Level: LogError, Time: time.Now()}))
+	waitFluentSender(t, a)
+	if !assert.Len(t, a.pending, 1) {
+		a.Unlock()
+		return
+	}
+	chunk := a.pending[0].chunk
+
+	// the next flush resends the batch, with the same chunk ID, on a new connection
+	a.ackTimeout = time.Second
+	a.nextDial = time.Time{}
+	a.flush()
+	a.Unlock()
+
+	msg := server.read(t)
+	assert.Equal(t, chunk, msg.options["chunk"])
+	assert.Equal(t, "lost", msg.entries[0].record["message"])
+
+	waitFluentSender(t, a)
+	defer a.Unlock()
+	assert.Empty(t, a.pending)
+}
+
+func TestFluentReconnect(t *testing.T) {
+	conn := &recordingConn{fail: true}
+	a := newFluentAppender(func() (net.Conn, error) {
+		return conn, nil
+	}, "app")
+	a.batchSize = 1
+	a.flushInterval = time.Minute
+
+	for _, msg := range []string{"a", "b"} {
+		m := []byte(msg)
+		assert.NoError(t, a.Append(&m, LogInfo, time.Now()))
+	}
+	waitFluentSender(t, a)
+	assert.Len(t, a.pending, 2)
+	assert.Nil(t, a.conn, "failed connection wasn't closed")
+	conn.fail = false
+	a.nextDial = time.Time{}
+	a.Unlock()
+
+	m := []byte("c")
+	assert.NoError(t, a.Append(&m, LogInfo, time.Now()))
+	waitFluentSender(t, a)
+	defer a.Unlock()
+	assert.Empty(t, a.pending)
+
+	var messages []string
+	for _, write := range conn.writes {
+		value, _, err := decodeMsgpack(write)
+		assert.NoError(t, err)
+		for _, entry := range decodeFluentMessage(t, value).entries {
+			messages = append(messages, entry.record["message"].(string))
+		}
+	}
+	assert.Equal(t, []string{"a", "b", "c"}, messages)
+}
+
+func TestFluentRedialBackoff(t *testing.T) {
+	var mu sync.Mutex
+	dials := 0
+	a := newFluentAppender(func() (net.Conn, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		dials++
+		return nil, errors.New("connection refused")
+	}, "app")
+	a.batchSize = 1
+
+	for i := 0; i < 3; i++ {
+		m := []byte("x")
+		a.appendEntry(&m, &Entry{Level: LogError, Time: time.Now()})
+		waitFluentSender(t, a)
+		a.Unlock()
+	}
+
+	a.Lock()
+	defer a.Unlock()
+	assert.Len(t, a.pending, 3)
+	assert.WithinDuration(t, time.Now().Add(fluentRedialInterval), a.nextDial, fluentRedialInterval)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 1, dials)
+	a.timer.Stop()
+}
+
+func TestFluentSendDoesNotBlockLogging(t *testing.T) {
+	release := make(chan struct{})
+	a := newFluentAppender(func() (net.Conn, error) {
+		<-release
+		return nil, errors.New("connection refused")
+	}, "app")
+	defer close(release)
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		m := []byte("x")
+		a.appendEntry(&m, &Entry{Level: LogError, Time: time.Now()})
+	}
+	assert.WithinDuration(t, start, time.Now(), 500*time.Millisecond)
+}
+
+func TestFluentSizeFlushStopsTimer(t *testing.T) {
+	a := newFluentAppender(func() (net.Conn, error) {
+		return &recordingConn{}, nil
+	}, "app")
+	a.batchSize = 2
+	a.flushInterval = time.Minute
+
+	for _, msg := range []string{"a", "b"} {
+		m := []byte(msg)
+		a.Append(&m, LogInfo, time.Now())
+	}
+	waitFluentSender(t, a)
+	defer a.Unlock()
+	assert.Nil(t, a.timer)
+	assert.Empty(t, a.pending)
+}
+
+func TestFluentPendingIsBounded(t *testing.T) {
+	a := newFluentAppender(func() (net.Conn, error) {
+		return nil, errors.New("connection refused")
+	}, "app")
+	a.batchSize = 1
+	a.flushInterval = time.Minute
+
+	for i := 0; i < maxFluentPendingBatch+5; i++ {
+		m := []byte("x")
+		a.Append(&m, LogInfo, time.Now())
+	}
+	waitFluentSender(t, a)
+	defer a.Unlock()
+	assert.Len(t, a.pending, maxFluentPendingBatch)
+	assert.Equal(t, 5, a.dropped)
+	a.timer.Stop()
+}
+
+func TestFluentRejectsOversizedAck(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	go func() {
+		// an array32 header claiming 2^32-1 elements, and more bytes than any ack
+		server.Write(append([]byte{0xdd, 0xff, 0xff, 0xff, 0xff}, make([]byte, 2*maxFluentAckBytes)...))
+		server.Close()
+	}()
+
+	a := newFluentAppender(nil, "app")
+	a.conn = client
+	err := a.readAck("chunk", time.Second)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "longer than")
+	}
+}
+
+func TestFluentInvalidTransport(t *testing.T) {
+	l := Logger(LogAll).ToFluent("udp", "localhost:24224", "app")
+	_, isFluent := l.(*logger).appender.(*fluentAppender)
+	assert.False(t, isFluent)
+}
@@ -2,13 +2,60 @@ package log5go
 
 import "time"
 
-// interface Formatter formats a log message into *out for passing to an Appender
+// interface Formatter formats a log entry into *out for passing to an Appender
 type Formatter interface {
 	Format(tstamp time.Time, level LogLevel, prefix, caller string, line uint, msg string, data Data, out *[]byte)
 	SetTimeFormat(timeFormat string)
 	SetLines(lines bool)
 }
 
+// interface EntryFormatter is implemented by formatters that format a whole Entry,
+// including the fields Format has no parameter for (stack traces, function names,
+// colors). The logger uses FormatEntry instead of Format when a formatter has it.
+type EntryFormatter interface {
+	FormatEntry(e *Entry, out *[]byte)
+}
+
+// formatEntry formats e into *out with f, passing the whole entry if f is an
+// EntryFormatter and just the fields Format takes otherwise
+func formatEntry(f Formatter, e *Entry, out *[]byte) {
+	if ef, ok := f.(EntryFormatter); ok {
+		ef.FormatEntry(e, out)
+		return
+	}
+	f.Format(e.Time, e.Level, e.Prefix, e.Caller, e.Line, e.Msg, e.Data, out)
+}
+
+// newEntry returns an Entry holding the parameters of Formatter.Format, for
+// formatters that implement Format with FormatEntry
+func newEntry(tstamp time.Time, level LogLevel, prefix, caller string, line uint, msg string, data Data) *Entry {
+	return &Entry{Time: tstamp, Level: level, Prefix: prefix, Caller: caller, Line: line, Msg: msg, Data: data}
+}
+
+// entryFields is a set of optional Entry fields that are expensive to fill in.
+// The logger only fills in the ones its formatter asks for.
+type entryFields uint8
+
+const (
+	fieldFunc      entryFields = 1 << iota // Entry.Func
+	fieldGoroutine                         // Entry.Goroutine
+	fieldElapsed                           // Entry.Elapsed
+	fieldCaller                            // Entry.Caller and Entry.Line, even without line info
+)
+
+// fieldRequester is implemented by formatters that need optional Entry fields
+type fieldRequester interface {
+	requiredFields() entryFields
+}
+
+// requiredFields returns the optional Entry fields needed by formatter f
+func requiredFields(f Formatter) entryFields {
+	if fr, ok := f.(fieldRequester); ok {
+		return fr.requiredFields()
+	}
+	return 0
+}
+
 // Some constant string formats for convenience, also used internally
 const (
 	FMT_Default            = "%t %l : %m"
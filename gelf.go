@@ -0,0 +1,318 @@
+package log5go
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// DefaultGELFChunkSize is the largest UDP datagram sent to a GELF server, which is
+// safe on most networks. Servers on a LAN can use larger chunks, up to 8192 bytes.
+const DefaultGELFChunkSize = 1420
+
+// DefaultGELFWriteTimeout is the maximum time a message may take to be written to a GELF
+// server. A stalled server can't block logging for longer.
+const DefaultGELFWriteTimeout = 5 * time.Second
+
+// GELF chunking limits
+const (
+	gelfChunkHeader = 12  // magic bytes, message ID, sequence number and count
+	maxGELFChunks   = 128 // chunks per message
+)
+
+// minimum time between attempts to connect to a GELF server that is down
+var gelfRedialInterval = time.Second
+
+var errGELFDown = errors.New("GELF server is unreachable")
+
+// gelfTruncated marks the end of a message that was truncated to fit in maxGELFChunks chunks
+const gelfTruncated = "... [truncated]"
+
+// gelfAppender sends GELF 1.1 messages to Graylog. Over UDP, messages larger than a
+// datagram are split into chunks and may be compressed. Over TCP, messages are
+// terminated by a null byte. Messages are dropped while the server is unreachable.
+type gelfAppender struct {
+	sync.Mutex
+	conn      net.Conn
+	dial      func() (net.Conn, error)
+	stream    bool // TCP, rather than UDP
+	host      string
+	compress  bool
+	chunkSize int
+	timeout   time.Duration // maximum time a write may take, 0 for none
+	nextDial  time.Time     // time of the next connection attempt while the server is down
+	msg       []byte        // buffer for the GELF message being written
+	value     []byte        // buffer for the field value being written
+	zbuf      bytes.Buffer
+	zw        *gzip.Writer
+}
+
+func newGELFAppender(dial func() (net.Conn, error), stream bool) *gelfAppender {
+	return &gelfAppender{
+		dial:      dial,
+		stream:    stream,
+		host:      processHostname(),
+		chunkSize: DefaultGELFChunkSize,
+		timeout:   DefaultGELFWriteTimeout,
+	}
+}
+
+func (a *gelfAppender) Append(msg *[]byte, level LogLevel, tstamp time.Time) error {
+	return a.appendEntry(msg, &Entry{Level: level, Time: tstamp})
+}
+
+// appendEntry sends the first line of msg as short_message, the whole of a multi-line
+// msg as full_message, and the entry's caller and data as additional fields. Over UDP,
+// a message too large for maxGELFChunks chunks is compressed, and if it is still too
+// large, its text is truncated.
+func (a *gelfAppender) appendEntry(msg *[]byte, e *Entry) error {
+	a.Lock()
+	defer a.Unlock()
+
+	text := bytes.TrimRight(*msg, "\n")
+	a.msg = a.format(a.msg[:0], e, text)
+	if a.stream {
+		return a.send(append(a.msg, 0))
+	}
+	limit := maxGELFChunks * (a.chunkSize - gelfChunkHeader)
+	if !a.compress && len(a.msg) <= limit {
+		return a.send(a.msg)
+	}
+	if z := a.gzip(a.msg); len(z) <= limit {
+		return a.send(z)
+	}
+
+	// escaping never makes text shorter, so cutting it by the excess is enough for the
+	// uncompressed message to fit. Don't cut a UTF-8 character in half.
+	end := len(text) - (len(a.msg) - limit) - len(gelfTruncated)
+	if end < 0 {
+		end = 0
+	}
+	for end > 0 && !utf8.RuneStart(text[end]) {
+		end--
+	}
+	a.msg = a.format(a.msg[:0], e, append(text[:end:end], gelfTruncated...))
+	if a.compress {
+		if z := a.gzip(a.msg); len(z) <= limit {
+			return a.send(z)
+		}
+	}
+	return a.send(a.msg)
+}
+
+// gzip returns msg compressed, in a buffer that is reused. Caller must hold the lock.
+func (a *gelfAppender) gzip(msg []byte) []byte {
+	a.zbuf.Reset()
+	if a.zw == nil {
+		a.zw = gzip.NewWriter(&a.zbuf)
+	} else {
+		a.zw.Reset(&a.zbuf)
+	}
+	a.zw.Write(msg)
+	a.zw.Close()
+	return a.zbuf.Bytes()
+}
+
+// format appends the GELF message for e to msg. Caller must hold the lock.
+func (a *gelfAppender) format(msg []byte, e *Entry, text []byte) []byte {
+	short := text
+	if i := bytes.IndexByte(text, '\n'); i >= 0 {
+		short = text[:i]
+	}
+
+	msg = append(msg, `{"version":"1.1","host":`...)
+	msg = appendJSONString(msg, a.host)
+	msg = append(msg, `,"short_message":`...)
+	msg = appendJSONString(msg, string(short))
+	if len(short) < len(text) {
+		msg = append(msg, `,"full_message":`...)
+		msg = appendJSONString(msg, string(text))
+	}
+	msg = append(msg, `,"timestamp":`...)
+	msg = strconv.AppendInt(msg, e.Time.Unix(), 10)
+	msg = append(msg, '.')
+	millis := e.Time.Nanosecond() / int(time.Millisecond)
+	msg = append(msg, byte('0'+millis/100), byte('0'+millis/10%10), byte('0'+millis%10))
+	msg = append(msg, `,"level":`...)
+	msg = strconv.AppendInt(msg, int64(DefaultSyslogSeverity(e.Level)), 10)
+	if e.Caller != "" {
+		msg = append(msg, `,"_file":`...)
+		msg = appendJSONString(msg, e.Caller)
+		msg = append(msg, `,"_line":`...)
+		msg = strconv.AppendUint(msg, uint64(e.Line), 10)
+	}
+
+	var scratch [16]string
+	for _, key := range sortedKeys(e.Data, scratch[:0]) {
+		value := e.Data[key]
+		if value == nil {
+			continue
+		}
+		msg = append(msg, ',', '"', '_')
+		msg = appendGELFFieldName(msg, key)
+		msg = append(msg, '"', ':')
+		msg = a.appendGELFValue(msg, value)
+	}
+	return append(msg, '}')
+}
+
+// appendGELFValue appends a data value as a GELF additional field, which must be a
+// number or a string. Caller must hold the lock.
+func (a *gelfAppender) appendGELFValue(msg []byte, value interface{}) []byte {
+	switch value.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, uintptr, float32, float64:
+		if number, err := appendJSONValue(msg, value); err == nil {
+			return number
+		}
+	}
+	a.value = a.value[:0]
+	appendDataValue(&a.value, value)
+	return appendJSONString(msg, string(a.value))
+}
+
+// appendGELFFieldName appends a data key as the name of an additional field, without its
+// leading '_'. Names may only contain letters, digits, '_', '.' and '-'; other characters
+// are replaced with '_'. The keys "id", "file" and "line", which would clash with the
+// reserved _id and the caller's _file and _line, are sent as __id, __file and __line.
+func appendGELFFieldName(msg []byte, key string) []byte {
+	if key == "" || key == "id" || key == "file" || key == "line" {
+		msg = append(msg, '_')
+	}
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '_' || c == '.' || c == '-') {
+			c = '_'
+		}
+		msg = append(msg, c)
+	}
+	return msg
+}
+
+// send writes a message to the GELF server, chunking it if necessary. Caller must hold the lock.
+func (a *gelfAppender) send(msg []byte) error {
+	if a.conn == nil {
+		now := time.Now()
+		if now.Before(a.nextDial) {
+			return errGELFDown
+		}
+		if err := a.connect(); err != nil {
+			a.nextDial = now.Add(gelfRedialInterval)
+			return err
+		}
+	}
+
+	if !a.stream && len(msg) > a.chunkSize {
+		return a.sendChunks(msg)
+	}
+
+	err := a.write(msg)
+	if err != nil && a.stream && !errors.Is(err, os.ErrDeadlineExceeded) {
+		// the server may have restarted, so reconnect and try once more
+		a.conn.Close()
+		a.conn = nil
+		if err = a.connect(); err != nil {
+			a.nextDial = time.Now().Add(gelfRedialInterval)
+			return err
+		}
+		err = a.write(msg)
+	}
+	return err
+}
+
+// write writes a message or chunk on the connection. If the write times out, the server
+// is stalled: the connection is closed and messages are dropped until the next
+// connection attempt. Caller must hold the lock.
+func (a *gelfAppender) write(b []byte) error {
+	if a.timeout > 0 {
+		a.conn.SetWriteDeadline(time.Now().Add(a.timeout))
+	}
+	_, err := a.conn.Write(b)
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		a.conn.Close()
+		a.conn = nil
+		a.nextDial = time.Now().Add(gelfRedialInterval)
+	}
+	return err
+}
+
+// sendChunks sends a message as GELF chunks: datagrams holding the magic bytes 0x1e 0x0f,
+// an 8 byte message ID, the chunk's sequence number and the number of chunks, followed
+// by part of the message. Caller must hold the lock.
+func (a *gelfAppender) sendChunks(msg []byte) error {
+	size := a.chunkSize - gelfChunkHeader
+	count := (len(msg) + size - 1) / size
+	if count > maxGELFChunks {
+		return fmt.Errorf("GELF message of %d bytes needs more than %d chunks", len(msg), maxGELFChunks)
+	}
+
+	chunk := make([]byte, 0, a.chunkSize)
+	id := rand.Uint64()
+	for i := 0; i < count; i++ {
+		chunk = append(chunk[:0], 0x1e, 0x0f,
+			byte(id>>56), byte(id>>48), byte(id>>40), byte(id>>32), byte(id>>24), byte(id>>16), byte(id>>8), byte(id),
+			byte(i), byte(count))
+		end := (i + 1) * size
+		if end > len(msg) {
+			end = len(msg)
+		}
+		chunk = append(chunk, msg[i*size:end]...)
+		if err := a.write(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// connect connects to the GELF server. Caller must hold the lock.
+func (a *gelfAppender) connect() (err error) {
+	a.conn, err = a.dial()
+	return err
+}
+
+func (a *gelfAppender) Concurrent() bool {
+	return true
+}
+
+// recordFormatter formats the message of appenders that send structured records, like
+// GELF and Fluent. Data is left out, as those appenders send it as separate fields, but
+// errors and stack traces are kept.
+type recordFormatter struct {
+	syslogFormatter
+}
+
+func newRecordFormatter() Formatter {
+	return &recordFormatter{*newSyslogFormatter(false).(*syslogFormatter)}
+}
+
+func (f *recordFormatter) Format(tstamp time.Time, level LogLevel, prefix, caller string, line uint, msg string, data Data, out *[]byte) {
+	f.FormatEntry(newEntry(tstamp, level, prefix, caller, line, msg, data), out)
+}
+
+func (f *recordFormatter) FormatEntry(e *Entry, out *[]byte) {
+	entry := *e
+	entry.Data = nil
+	if key, err := entryError(e.Data); err != nil {
+		entry.Data = Data{key: err}
+	}
+	if e.Prefix == "" {
+		f.noPrefix.FormatEntry(&entry, out)
+	} else {
+		f.formatter.FormatEntry(&entry, out)
+	}
+}
+
+func (f *recordFormatter) requiredFields() entryFields {
+	return f.syslogFormatter.requiredFields() | fieldCaller
+}
+
+func (f *recordFormatter) SetLines(lines bool) {
+	// NOOP: the caller is sent as separate fields
+}
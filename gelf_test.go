@@ -0,0 +1,308 @@
+package log5go
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// listenGELFUDP creates a UDP socket standing in for a Graylog GELF input
+func listenGELFUDP(t *testing.T) net.PacketConn {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip("can't listen on UDP: ", err)
+	}
+	return conn
+}
+
+// readGELFDatagram reads a single datagram
+func readGELFDatagram(t *testing.T, conn net.PacketConn) []byte {
+	buf := make([]byte, 64<<10)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf[:n]
+}
+
+// readGELFMessage reads a message sent over UDP, reassembling and decompressing it like Graylog does
+func readGELFMessage(t *testing.T, conn net.PacketConn) map[string]interface{} {
+	msg := readGELFDatagram(t, conn)
+	if bytes.HasPrefix(msg, []byte{0x1e, 0x0f}) {
+		id, count := string(msg[2:10]), int(msg[11])
+		chunks := make([][]byte, count)
+		for {
+			if string(msg[2:10]) != id || int(msg[11]) != count {
+				t.Fatalf("chunk from another message")
+			}
+			chunks[msg[10]] = msg[12:]
+			complete := true
+			for _, chunk := range chunks {
+				complete = complete && chunk != nil
+			}
+			if complete {
+				break
+			}
+			msg = readGELFDatagram(t, conn)
+		}
+		msg = bytes.Join(chunks, nil)
+	}
+
+	if bytes.HasPrefix(msg, []byte{0x1f, 0x8b}) {
+		r, err := gzip.NewReader(bytes.NewReader(msg))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg, err = io.ReadAll(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return decodeGELF(t, msg)
+}
+
+func decodeGELF(t *testing.T, msg []byte) map[string]interface{} {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(msg, &fields); err != nil {
+		t.Fatalf("invalid GELF message %q: %v", msg, err)
+	}
+	return fields
+}
+
+func TestGELFUDP(t *testing.T) {
+	server := listenGELFUDP(t)
+	defer server.Close()
+
+	l := Logger(LogAll).ToGELF("udp", server.LocalAddr().String()).WithPrefix("web")
+	l.WithData(Data{"user": "bob", "attempt": 3, "ok": false, "id": "abc", "request id": "r1"}).Warn("login failed")
+
+	fields := readGELFMessage(t, server)
+	assert.Equal(t, "1.1", fields["version"])
+	assert.Equal(t, processHostname(), fields["host"])
+	assert.Equal(t, "web: login failed", fields["short_message"])
+	assert.NotContains(t, fields, "full_message")
+	assert.Equal(t, float64(4), fields["level"])
+	assert.InDelta(t, float64(time.Now().Unix()), fields["timestamp"], 5)
+	assert.True(t, strings.HasSuffix(fields["_file"].(string), "/gelf_test.go"), fields["_file"])
+	assert.NotZero(t, fields["_line"])
+	assert.Equal(t, "bob", fields["_user"])
+	assert.Equal(t, float64(3), fields["_attempt"])
+	assert.Equal(t, "false", fields["_ok"])
+	assert.Equal(t, "abc", fields["__id"])
+	assert.Equal(t, "r1", fields["_request_id"])
+	assert.NotContains(t, fields, "_id")
+}
+
+func TestGELFFullMessage(t *testing.T) {
+	server := listenGELFUDP(t)
+	defer server.Close()
+
+	l := Logger(LogAll).ToGELF("udp", server.LocalAddr().String()).WithStackTrace(LogError)
+	l.WithData(Data{"error": errors.New("disk full")}).Error("write failed")
+
+	fields := readGELFMessage(t, server)
+	assert.Equal(t, "write failed", fields["short_message"])
+	full, _ := fields["full_message"].(string)
+	assert.True(t, strings.HasPrefix(full, "write failed\n"), full)
+	assert.Contains(t, full, "disk full")
+	assert.Contains(t, full, "TestGELFFullMessage")
+	assert.Equal(t, "disk full", fields["_error"])
+	assert.Equal(t, float64(3), fields["level"])
+}
+
+func TestGELFChunking(t *testing.T) {
+	server := listenGELFUDP(t)
+	defer server.Close()
+
+	l := Logger(LogAll).ToGELF("udp", server.LocalAddr().String()).WithGELFChunkSize(200)
+	long := strings.Repeat("0123456789", 100)
+	l.Info(long)
+
+	fields := readGELFMessage(t, server)
+	assert.Equal(t, long, fields["short_message"])
+}
+
+func TestGELFChunkLimit(t *testing.T) {
+	a := newGELFAppender(func() (net.Conn, error) { return &recordingConn{}, nil }, false)
+	a.chunkSize = 100
+	msg := make([]byte, 129*(100-gelfChunkHeader))
+	assert.NoError(t, a.connect())
+	assert.Error(t, a.sendChunks(msg))
+	assert.Empty(t, a.conn.(*recordingConn).writes)
+
+	assert.NoError(t, a.sendChunks(msg[:128*(100-gelfChunkHeader)]))
+	writes := a.conn.(*recordingConn).writes
+	assert.Len(t, writes, 128)
+	for i, chunk := range writes {
+		assert.Len(t, chunk, 100)
+		assert.Equal(t, byte(i), chunk[10])
+		assert.Equal(t, byte(128), chunk[11])
+		assert.Equal(t, writes[0][2:10], chunk[2:10])
+	}
+}
+
+func TestGELFOversizedMessage(t *testing.T) {
+	// reassemble decodes the message sent as chunks on conn
+	reassemble := func(conn *recordingConn) map[string]interface{} {
+		if !assert.NotEmpty(t, conn.writes) || !assert.LessOrEqual(t, len(conn.writes), maxGELFChunks) {
+			return nil
+		}
+		var msg []byte
+		for _, chunk := range conn.writes {
+			msg = append(msg, chunk[gelfChunkHeader:]...)
+		}
+		if bytes.HasPrefix(msg, []byte{0x1f, 0x8b}) {
+			r, err := gzip.NewReader(bytes.NewReader(msg))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if msg, err = io.ReadAll(r); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return decodeGELF(t, msg)
+	}
+	limit := maxGELFChunks * (100 - gelfChunkHeader)
+
+	// too many chunks uncompressed, but compression makes it fit
+	conn := &recordingConn{}
+	a := newGELFAppender(func() (net.Conn, error) { return conn, nil }, false)
+	a.chunkSize = 100
+	compressible := "first line\n" + strings.Repeat("0123456789", limit/10)
+	m := []byte(compressible)
+	assert.NoError(t, a.Append(&m, LogInfo, time.Now()))
+	fields := reassemble(conn)
+	assert.Equal(t, "first line", fields["short_message"])
+	assert.Equal(t, compressible, fields["full_message"])
+
+	// too many chunks even compressed, so the text is truncated
+	conn = &recordingConn{}
+	a = newGELFAppender(func() (net.Conn, error) { return conn, nil }, false)
+	a.chunkSize = 100
+	rnd := rand.New(rand.NewSource(1))
+	var noise strings.Builder
+	for noise.Len() < 2*limit {
+		r := rune('!' + rnd.Intn(90))
+		if r == '\\' {
+			r = 'é'
+		}
+		noise.WriteRune(r)
+	}
+	incompressible := "first line\n" + noise.String()
+	m = []byte(incompressible)
+	assert.NoError(t, a.Append(&m, LogInfo, time.Now()))
+	fields = reassemble(conn)
+	assert.Equal(t, "first line", fields["short_message"])
+	full, _ := fields["full_message"].(string)
+	assert.True(t, strings.HasSuffix(full, gelfTruncated), "full_message wasn't marked as truncated")
+	assert.True(t, strings.HasPrefix(incompressible, strings.TrimSuffix(full, gelfTruncated)))
+	assert.True(t, utf8.ValidString(full))
+}
+
+func TestGELFCompression(t *testing.T) {
+	server := listenGELFUDP(t)
+	defer server.Close()
+
+	l := Logger(LogAll).ToGELF("udp", server.LocalAddr().String()).WithGELFCompression(true)
+	l.Info("first")
+	msg := readGELFDatagram(t, server)
+	assert.True(t, bytes.HasPrefix(msg, []byte{0x1f, 0x8b}), "message wasn't gzipped")
+
+	// compressed messages are chunked too
+	l.WithGELFChunkSize(100).WithData(Data{"noise": strings.Repeat("x", 300) + time.Now().String()}).Info("second")
+	fields := readGELFMessage(t, server)
+	assert.Equal(t, "second", fields["short_message"])
+}
+
+func TestGELFTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip("can't listen on TCP: ", err)
+	}
+	defer ln.Close()
+
+	l := Logger(LogAll).ToGELF("tcp", ln.Addr().String()).WithGELFCompression(true)
+	conn, err := ln.Accept()
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+
+	l.Info("first")
+	l.Info("second\nline two")
+
+	r := bufio.NewReader(conn)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	for _, expected := range []string{"first", "second"} {
+		msg, err := r.ReadBytes(0)
+		if !assert.NoError(t, err) {
+			return
+		}
+		fields := decodeGELF(t, msg[:len(msg)-1])
+		assert.Equal(t, expected, fields["short_message"])
+	}
+}
+
+func TestGELFServerDown(t *testing.T) {
+	attempts := 0
+	a := newGELFAppender(func() (net.Conn, error) {
+		attempts++
+		return nil, errors.New("connection refused")
+	}, true)
+
+	m := []byte("x")
+	assert.Error(t, a.Append(&m, LogInfo, time.Now()))
+	assert.Error(t, a.Append(&m, LogInfo, time.Now()))
+	assert.Equal(t, 1, attempts, "redialed too soon")
+}
+
+func TestGELFStalledServer(t *testing.T) {
+	// nothing reads from the other end of the pipe, so writes block until the deadline
+	stalled, server := net.Pipe()
+	defer server.Close()
+	attempts := 0
+	a := newGELFAppender(func() (net.Conn, error) {
+		attempts++
+		return stalled, nil
+	}, true)
+	a.timeout = 20 * time.Millisecond
+
+	start := time.Now()
+	m := []byte("x")
+	assert.Error(t, a.Append(&m, LogInfo, time.Now()))
+	assert.Error(t, a.Append(&m, LogInfo, time.Now()))
+	assert.Less(t, time.Since(start), time.Second, "append blocked on a stalled server")
+	assert.Equal(t, 1, attempts, "redialed too soon")
+}
+
+func TestGELFInvalidTransport(t *testing.T) {
+	l := Logger(LogAll).ToGELF("sctp", "localhost:12201")
+	_, isGELF := l.(*logger).appender.(*gelfAppender)
+	assert.False(t, isGELF)
+}
+
+func TestGELFFieldName(t *testing.T) {
+	var tests = map[string]string{
+		"user":       "user",
+		"request-id": "request-id",
+		"a.b":        "a.b",
+		"a b/c":      "a_b_c",
+		"id":         "_id",
+		"file":       "_file",
+		"":           "_",
+	}
+	for key, expected := range tests {
+		assert.Equal(t, expected, string(appendGELFFieldName(nil, key)), key)
+	}
+}
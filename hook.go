@@ -0,0 +1,58 @@
+package log5go
+
+import "fmt"
+
+// HookErrorKey is the data key under which a panicking hook is reported
+const HookErrorKey = "log5go_hook_error"
+
+// Hook is run on every entry that passes a logger's threshold, before the entry is
+// formatted. Hooks may modify the entry: add or remove data, change the level or
+// rewrite the message. Returning false drops the entry.
+//
+// The entry's Data is a copy of the logged data, so hooks can change it freely.
+// It is nil if no data was logged. Hooks must not keep the entry after Fire returns.
+type Hook interface {
+	Fire(e *Entry) bool
+}
+
+// HookFunc adapts an ordinary function to the Hook interface
+type HookFunc func(e *Entry) bool
+
+func (f HookFunc) Fire(e *Entry) bool {
+	return f(e)
+}
+
+// runHooks runs the logger's hooks in order, returning false if the entry should
+// be dropped. An entry whose level a hook lowered below the logger's threshold is
+// dropped too.
+func (l *logger) runHooks(e *Entry) bool {
+	if e.Data != nil {
+		data := make(Data, len(e.Data))
+		for key, value := range e.Data {
+			data[key] = value
+		}
+		e.Data = data
+	}
+
+	for _, h := range l.hooks {
+		if !fireHook(h, e) {
+			return false
+		}
+	}
+	return e.Level >= l.level
+}
+
+// fireHook runs h, recovering from panics. The panic is recorded in the entry's
+// data and the entry is kept.
+func fireHook(h Hook, e *Entry) (keep bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			if e.Data == nil {
+				e.Data = Data{}
+			}
+			e.Data[HookErrorKey] = fmt.Sprintf("hook %T panicked: %v", h, r)
+			keep = true
+		}
+	}()
+	return h.Fire(e)
+}
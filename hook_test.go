@@ -0,0 +1,104 @@
+package log5go
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHooksRunInOrder(t *testing.T) {
+	var buf bytes.Buffer
+	var order []string
+	l := Logger(LogAll).ToWriter(&buf).WithFmt("%l %m").
+		WithHook(HookFunc(func(e *Entry) bool {
+			order = append(order, "first")
+			e.Msg = "[" + e.Msg + "]"
+			return true
+		})).
+		WithHook(HookFunc(func(e *Entry) bool {
+			order = append(order, "second")
+			if e.Data == nil {
+				e.Data = Data{}
+			}
+			e.Data["host"] = "web1"
+			return true
+		}))
+
+	l.Info("hello")
+	assert.Equal(t, []string{"first", "second"}, order)
+	assert.Equal(t, "INFO [hello] host=\"web1\"\n", buf.String())
+}
+
+func TestHookDropsEntries(t *testing.T) {
+	var buf bytes.Buffer
+	l := Logger(LogAll).ToWriter(&buf).WithFmt("%m").WithHook(HookFunc(func(e *Entry) bool {
+		return !strings.Contains(e.Msg, "healthcheck")
+	}))
+
+	l.Info("GET /healthcheck")
+	l.Info("GET /users")
+	assert.Equal(t, "GET /users\n", buf.String())
+}
+
+func TestHookChangesLevel(t *testing.T) {
+	var buf bytes.Buffer
+	l := Logger(LogInfo).ToWriter(&buf).WithFmt("%l %m").WithHook(HookFunc(func(e *Entry) bool {
+		switch e.Msg {
+		case "noisy":
+			e.Level = LogDebug
+		case "important":
+			e.Level = LogError
+		}
+		return true
+	}))
+
+	l.Error("noisy")
+	l.Info("important")
+	assert.Equal(t, "ERROR important\n", buf.String())
+}
+
+func TestHookDoesntModifyBoundData(t *testing.T) {
+	var buf bytes.Buffer
+	l := Logger(LogAll).ToWriter(&buf).WithFmt("%m").WithHook(HookFunc(func(e *Entry) bool {
+		e.Data["added"] = true
+		delete(e.Data, "secret")
+		return true
+	}))
+
+	d := Data{"secret": "hunter2"}
+	l.WithData(d).Info("login")
+	assert.Equal(t, "login added=true\n", buf.String())
+	assert.Equal(t, Data{"secret": "hunter2"}, d)
+}
+
+type panickingHook struct{}
+
+func (panickingHook) Fire(e *Entry) bool {
+	panic("boom")
+}
+
+func TestPanickingHook(t *testing.T) {
+	var buf bytes.Buffer
+	count := 0
+	l := Logger(LogAll).ToWriter(&buf).WithFmt("%m").
+		WithHook(panickingHook{}).
+		WithHook(HookFunc(func(e *Entry) bool {
+			count++
+			return true
+		}))
+
+	assert.NotPanics(t, func() { l.Info("still logged") })
+	assert.Equal(t, 1, count, "hooks after the panicking hook didn't run")
+	assert.Equal(t, "still logged log5go_hook_error=\"hook log5go.panickingHook panicked: boom\"\n", buf.String())
+}
+
+func TestCloneCopiesHooks(t *testing.T) {
+	h := HookFunc(func(e *Entry) bool { return true })
+	l1 := Logger(LogAll).WithHook(h)
+	l2 := l1.Clone().WithHook(h)
+
+	assert.Len(t, l1.(*logger).hooks, 1)
+	assert.Len(t, l2.(*logger).hooks, 2)
+}
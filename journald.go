@@ -0,0 +1,172 @@
+package log5go
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// location of journald's native protocol socket
+const journaldSocket = "/run/systemd/journal/socket"
+
+// journal field names are at most 64 characters
+const maxJournalFieldName = 64
+
+// journal fields set by the journald appender. Data keys that map to one of these are dropped.
+var journalFields = map[string]bool{
+	"MESSAGE":           true,
+	"PRIORITY":          true,
+	"SYSLOG_IDENTIFIER": true,
+	"CODE_FILE":         true,
+	"CODE_LINE":         true,
+	"CODE_FUNC":         true,
+}
+
+// journaldAppender sends messages to the systemd journal using journald's native protocol.
+// Every message is a datagram of fields; entries too large for a datagram are passed to
+// journald in a temporary file. The socket isn't connected, so messages reach journald
+// again as soon as it restarts.
+type journaldAppender struct {
+	sync.Mutex
+	addr       *net.UnixAddr // journald's socket
+	conn       *net.UnixConn // unconnected socket messages are sent from
+	identifier string
+	entry      []byte // buffer for the journal entry being written
+	value      []byte // buffer for the field value being written
+}
+
+func newJournaldAppender(path string, identifier string) *journaldAppender {
+	return &journaldAppender{
+		addr:       &net.UnixAddr{Name: path, Net: "unixgram"},
+		identifier: identifier,
+	}
+}
+
+// open checks that journald is listening and opens the socket messages are sent from
+func (a *journaldAppender) open() (err error) {
+	if _, err = os.Stat(a.addr.Name); err != nil {
+		return err
+	}
+	a.conn, err = net.ListenUnixgram("unixgram", &net.UnixAddr{Net: "unixgram"})
+	return err
+}
+
+func (a *journaldAppender) Append(msg *[]byte, level LogLevel, tstamp time.Time) error {
+	return a.appendEntry(msg, &Entry{Level: level, Time: tstamp})
+}
+
+// appendEntry sends msg as the journal entry's MESSAGE, with the entry's caller info
+// and data as separate fields
+func (a *journaldAppender) appendEntry(msg *[]byte, e *Entry) error {
+	a.Lock()
+	defer a.Unlock()
+
+	a.entry = a.format(a.entry[:0], e, bytes.TrimSuffix(*msg, []byte{'\n'}))
+	_, err := a.conn.WriteToUnix(a.entry, a.addr)
+	if err != nil && isMessageTooLong(err) {
+		return sendJournalFile(a.conn, a.addr, a.entry)
+	}
+	return err
+}
+
+// format appends the journal entry for e to entry. Caller must hold the lock.
+func (a *journaldAppender) format(entry []byte, e *Entry, msg []byte) []byte {
+	entry = appendJournalField(entry, "MESSAGE", msg)
+	a.value = strconv.AppendInt(a.value[:0], int64(DefaultSyslogSeverity(e.Level)), 10)
+	entry = appendJournalField(entry, "PRIORITY", a.value)
+	if a.identifier != "" {
+		entry = appendJournalField(entry, "SYSLOG_IDENTIFIER", []byte(a.identifier))
+	}
+	if e.Caller != "" {
+		entry = appendJournalField(entry, "CODE_FILE", []byte(e.Caller))
+		a.value = strconv.AppendUint(a.value[:0], uint64(e.Line), 10)
+		entry = appendJournalField(entry, "CODE_LINE", a.value)
+	}
+	if e.Func != "" && e.Func != "???" {
+		entry = appendJournalField(entry, "CODE_FUNC", []byte(e.Func))
+	}
+
+	var scratch [16]string
+	var name [maxJournalFieldName]byte
+	for _, key := range sortedKeys(e.Data, scratch[:0]) {
+		fieldName := journalFieldName(name[:0], key)
+		if len(fieldName) == 0 || journalFields[string(fieldName)] {
+			continue
+		}
+		a.value = a.value[:0]
+		appendDataValue(&a.value, e.Data[key])
+		entry = appendJournalField(entry, string(fieldName), a.value)
+	}
+	return entry
+}
+
+func (a *journaldAppender) Concurrent() bool {
+	return true
+}
+
+// appendJournalField appends a field in journald's native format. Values without a
+// newline are sent as NAME=value. Other values are sent as NAME, a newline, the value's
+// length as a little-endian 64-bit integer and the value, so they can contain anything.
+func appendJournalField(entry []byte, name string, value []byte) []byte {
+	entry = append(entry, name...)
+	if bytes.IndexByte(value, '\n') < 0 {
+		entry = append(entry, '=')
+		entry = append(entry, value...)
+		return append(entry, '\n')
+	}
+
+	entry = append(entry, '\n')
+	var size [8]byte
+	binary.LittleEndian.PutUint64(size[:], uint64(len(value)))
+	entry = append(entry, size[:]...)
+	entry = append(entry, value...)
+	return append(entry, '\n')
+}
+
+// journalFieldName appends key to name as a journal field name: uppercase letters,
+// digits and underscores, not starting with an underscore or digit, which journald
+// reserves or rejects. Other characters are replaced with '_'. Returns an empty name
+// if nothing is left of key.
+func journalFieldName(name []byte, key string) []byte {
+	for i := 0; i < len(key) && len(name) < maxJournalFieldName; i++ {
+		c := key[i]
+		switch {
+		case 'a' <= c && c <= 'z':
+			c -= 'a' - 'A'
+		case 'A' <= c && c <= 'Z':
+		case '0' <= c && c <= '9' || c == '_':
+			if len(name) == 0 {
+				continue
+			}
+		default:
+			if len(name) == 0 {
+				continue
+			}
+			c = '_'
+		}
+		name = append(name, c)
+	}
+	return name
+}
+
+// journaldFormatter formats MESSAGE like the syslog formatter. It asks for the caller's
+// file, line and function, which the journald appender sends as separate fields.
+type journaldFormatter struct {
+	syslogFormatter
+}
+
+func newJournaldFormatter() Formatter {
+	return &journaldFormatter{*newSyslogFormatter(false).(*syslogFormatter)}
+}
+
+func (f *journaldFormatter) requiredFields() entryFields {
+	return f.syslogFormatter.requiredFields() | fieldCaller | fieldFunc
+}
+
+func (f *journaldFormatter) SetLines(lines bool) {
+	// NOOP: the caller is sent in CODE_FILE and CODE_LINE
+}
@@ -0,0 +1,69 @@
+package log5go
+
+import (
+	"errors"
+	"net"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// isMessageTooLong returns true if a datagram couldn't be sent because of its size
+func isMessageTooLong(err error) bool {
+	return errors.Is(err, syscall.EMSGSIZE) || errors.Is(err, syscall.ENOBUFS)
+}
+
+// sendJournalFile passes an entry too large for a datagram to journald in a sealed memfd,
+// or in an unlinked temporary file if memfds aren't supported, as sd_journal_send does
+func sendJournalFile(conn *net.UnixConn, addr *net.UnixAddr, entry []byte) error {
+	f, err := journalMemfd(entry)
+	if err != nil {
+		if f, err = journalTempFile(entry); err != nil {
+			return err
+		}
+	}
+	defer f.Close()
+
+	_, _, err = conn.WriteMsgUnix(nil, syscall.UnixRights(int(f.Fd())), addr)
+	return err
+}
+
+// journalMemfd returns a memfd holding entry, sealed so that it can't change once
+// journald has it
+func journalMemfd(entry []byte) (*os.File, error) {
+	fd, err := unix.MemfdCreate("log5go-journal", unix.MFD_CLOEXEC|unix.MFD_ALLOW_SEALING)
+	if err != nil {
+		return nil, err
+	}
+	f := os.NewFile(uintptr(fd), "log5go-journal")
+	if _, err = f.Write(entry); err == nil {
+		_, err = unix.FcntlInt(f.Fd(), unix.F_ADD_SEALS, unix.F_SEAL_SEAL|unix.F_SEAL_SHRINK|unix.F_SEAL_GROW|unix.F_SEAL_WRITE)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// journalTempFile returns an unlinked temporary file holding entry, in /dev/shm or else
+// /tmp. $TMPDIR isn't used, as journald may not be able to read files there.
+func journalTempFile(entry []byte) (f *os.File, err error) {
+	for _, dir := range []string{"/dev/shm", "/tmp"} {
+		if f, err = os.CreateTemp(dir, "log5go-journal-"); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = os.Remove(f.Name()); err == nil {
+		_, err = f.Write(entry)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
@@ -0,0 +1,78 @@
+package log5go
+
+import (
+	"io"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+func TestJournaldLargeEntryIsSentInFile(t *testing.T) {
+	server, path := listenJournald(t)
+	defer server.Close()
+
+	l := Logger(LogAll)
+	if !assert.NoError(t, l.(*logger).toJournald(path, "myapp")) {
+		return
+	}
+	big := strings.Repeat("x", 4<<20)
+	l.Info(big)
+
+	buf := make([]byte, 1024)
+	oob := make([]byte, syscall.CmsgSpace(4))
+	server.SetReadDeadline(time.Now().Add(time.Second))
+	n, oobn, _, _, err := server.ReadMsgUnix(buf, oob)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 0, n, "expected no data besides the file descriptor")
+
+	msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	if !assert.NoError(t, err) || !assert.Len(t, msgs, 1) {
+		return
+	}
+	fds, err := syscall.ParseUnixRights(&msgs[0])
+	if !assert.NoError(t, err) || !assert.Len(t, fds, 1) {
+		return
+	}
+	f := os.NewFile(uintptr(fds[0]), "journal entry")
+	defer f.Close()
+
+	info, err := f.Stat()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0), info.Sys().(*syscall.Stat_t).Nlink, "file wasn't unlinked")
+	if seals, err := unix.FcntlInt(f.Fd(), unix.F_GET_SEALS, 0); err == nil {
+		assert.NotZero(t, seals&unix.F_SEAL_WRITE, "memfd wasn't sealed")
+	}
+
+	f.Seek(0, io.SeekStart)
+	entry, err := io.ReadAll(f)
+	assert.NoError(t, err)
+	fields, err := parseJournalEntry(entry)
+	assert.NoError(t, err)
+	assert.Equal(t, big, fields["MESSAGE"])
+	assert.Equal(t, "myapp", fields["SYSLOG_IDENTIFIER"])
+}
+
+func TestJournalTempFile(t *testing.T) {
+	f, err := journalTempFile([]byte("MESSAGE=hello\n"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer f.Close()
+
+	assert.Regexp(t, `^/(dev/shm|tmp)/log5go-journal-`, f.Name())
+	info, err := f.Stat()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0), info.Sys().(*syscall.Stat_t).Nlink, "file wasn't unlinked")
+
+	f.Seek(0, io.SeekStart)
+	entry, err := io.ReadAll(f)
+	assert.NoError(t, err)
+	assert.Equal(t, "MESSAGE=hello\n", string(entry))
+}
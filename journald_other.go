@@ -0,0 +1,19 @@
+//go:build !linux
+// +build !linux
+
+package log5go
+
+import (
+	"errors"
+	"net"
+)
+
+// journald only runs on Linux, so entries are never passed in files elsewhere
+
+func isMessageTooLong(err error) bool {
+	return false
+}
+
+func sendJournalFile(conn *net.UnixConn, addr *net.UnixAddr, entry []byte) error {
+	return errors.New("journald is only supported on Linux")
+}
@@ -0,0 +1,168 @@
+package log5go
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// listenJournald creates a unixgram socket standing in for journald's
+func listenJournald(t *testing.T) (*net.UnixConn, string) {
+	path := filepath.Join(t.TempDir(), "journal.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Skip("can't listen on unixgram socket: ", err)
+	}
+	return conn, path
+}
+
+// readJournalEntry reads a datagram and parses its fields
+func readJournalEntry(t *testing.T, conn *net.UnixConn) map[string]string {
+	buf := make([]byte, 64<<10)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields, err := parseJournalEntry(buf[:n])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fields
+}
+
+// parseJournalEntry parses journald's native format, like journald does
+func parseJournalEntry(b []byte) (map[string]string, error) {
+	fields := make(map[string]string)
+	for len(b) > 0 {
+		nl := strings.IndexByte(string(b), '\n')
+		if nl < 0 {
+			return nil, errors.New("unterminated field")
+		}
+		if eq := strings.IndexByte(string(b[:nl]), '='); eq >= 0 {
+			fields[string(b[:eq])] = string(b[eq+1 : nl])
+			b = b[nl+1:]
+			continue
+		}
+
+		name := string(b[:nl])
+		b = b[nl+1:]
+		if len(b) < 8 {
+			return nil, errors.New("missing field length")
+		}
+		size := binary.LittleEndian.Uint64(b)
+		b = b[8:]
+		if uint64(len(b)) < size+1 || b[size] != '\n' {
+			return nil, errors.New("bad field length")
+		}
+		fields[name] = string(b[:size])
+		b = b[size+1:]
+	}
+	return fields, nil
+}
+
+func TestJournald(t *testing.T) {
+	server, path := listenJournald(t)
+	defer server.Close()
+
+	l := Logger(LogAll)
+	if !assert.NoError(t, l.(*logger).toJournald(path, "myapp")) {
+		return
+	}
+	l.WithPrefix("web").WithData(Data{"user": "bob", "attempt": 3, "request-id": "abc"}).Warn("login failed")
+
+	fields := readJournalEntry(t, server)
+	assert.Equal(t, "web: login failed", fields["MESSAGE"])
+	assert.Equal(t, "4", fields["PRIORITY"])
+	assert.Equal(t, "myapp", fields["SYSLOG_IDENTIFIER"])
+	assert.True(t, strings.HasSuffix(fields["CODE_FILE"], "/journald_test.go"), fields["CODE_FILE"])
+	assert.NotEmpty(t, fields["CODE_LINE"])
+	assert.Equal(t, "github.com/neocortical/log5go.TestJournald", fields["CODE_FUNC"])
+	assert.Equal(t, "bob", fields["USER"])
+	assert.Equal(t, "3", fields["ATTEMPT"])
+	assert.Equal(t, "abc", fields["REQUEST_ID"])
+}
+
+func TestJournaldMultilineValues(t *testing.T) {
+	server, path := listenJournald(t)
+	defer server.Close()
+
+	l := Logger(LogAll)
+	if !assert.NoError(t, l.(*logger).toJournald(path, "myapp")) {
+		return
+	}
+	l.WithData(Data{"trace": "line 1\nline 2=x\n"}).Error("first\nsecond")
+
+	fields := readJournalEntry(t, server)
+	assert.Equal(t, "first\nsecond", fields["MESSAGE"])
+	assert.Equal(t, "line 1\nline 2=x\n", fields["TRACE"])
+	assert.Equal(t, "3", fields["PRIORITY"])
+}
+
+func TestJournaldReservedFields(t *testing.T) {
+	server, path := listenJournald(t)
+	defer server.Close()
+
+	l := Logger(LogAll)
+	if !assert.NoError(t, l.(*logger).toJournald(path, "myapp")) {
+		return
+	}
+	l.WithData(Data{"priority": "high", "_PID": 1, "1st": "x", "message": "spoofed"}).Info("hello")
+
+	fields := readJournalEntry(t, server)
+	assert.Equal(t, "hello", fields["MESSAGE"])
+	assert.Equal(t, "6", fields["PRIORITY"])
+	assert.Equal(t, "x", fields["ST"])
+	assert.Equal(t, "1", fields["PID"])
+}
+
+func TestJournaldRestart(t *testing.T) {
+	server, path := listenJournald(t)
+
+	l := Logger(LogAll)
+	if !assert.NoError(t, l.(*logger).toJournald(path, "myapp")) {
+		return
+	}
+	l.Info("one")
+	assert.Equal(t, "one", readJournalEntry(t, server)["MESSAGE"])
+
+	// journald restarts
+	server.Close()
+	server, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Skip("can't listen on unixgram socket: ", err)
+	}
+	defer server.Close()
+
+	l.Info("two")
+	assert.Equal(t, "two", readJournalEntry(t, server)["MESSAGE"])
+}
+
+func TestJournalFieldName(t *testing.T) {
+	var tests = map[string]string{
+		"user":                   "USER",
+		"request-id":             "REQUEST_ID",
+		"_trusted":               "TRUSTED",
+		"42answer":               "ANSWER",
+		"__":                     "",
+		"a.b c":                  "A_B_C",
+		strings.Repeat("x", 100): strings.Repeat("X", maxJournalFieldName),
+	}
+	for key, expected := range tests {
+		assert.Equal(t, expected, string(journalFieldName(nil, key)), key)
+	}
+}
+
+func TestJournaldUnavailable(t *testing.T) {
+	l := Logger(LogAll)
+	err := l.(*logger).toJournald(filepath.Join(t.TempDir(), "missing.sock"), "myapp")
+	assert.Error(t, err)
+	_, isJournald := l.(*logger).appender.(*journaldAppender)
+	assert.False(t, isJournald)
+}
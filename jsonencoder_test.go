@@ -0,0 +1,83 @@
+package log5go
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_appendJSONStringMatchesEncodingJson(t *testing.T) {
+	for _, s := range []string{"", "hello", "侍 samurai", "quote\" backslash\\ slash/", "\n\r\t\x00\x1f\x7f", "line\u2028sep\u2029", "bad\xffutf8"} {
+		expected, _ := json.Marshal(s)
+		assert.Equal(t, string(expected), string(appendJSONString(nil, s)))
+	}
+}
+
+func Test_appendJSONValueMatchesEncodingJson(t *testing.T) {
+	for _, v := range []interface{}{nil, true, false, 0, -42, int8(-8), int16(16), int32(32), int64(math.MinInt64),
+		uint(1), uint8(8), uint16(16), uint32(32), uint64(math.MaxUint64), 3.14159265359, -0.0, 1e-7, 1e21, 123456789.0,
+		float32(3.14), float32(1e-7), []string{"a", "b"}, Data{"b": 1, "a": "x"}, map[string]interface{}{"nested": Data{"z": nil}},
+		struct{ Foo string }{"bar"}} {
+		expected, _ := json.Marshal(v)
+		actual, err := appendJSONValue(nil, v)
+		assert.Nil(t, err)
+		assert.Equal(t, string(expected), string(actual))
+	}
+}
+
+func Test_appendJSONValueErrors(t *testing.T) {
+	_, err := appendJSONValue(nil, math.NaN())
+	assert.NotNil(t, err)
+	_, err = appendJSONValue(nil, float32(math.Inf(1)))
+	assert.NotNil(t, err)
+}
+
+func Test_JsonFormatterFallback(t *testing.T) {
+	var buf []byte
+	f := &jsonFormatter{timeFormat: "2006"}
+	f.FormatEntry(&Entry{Time: time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC), Level: LogInfo, Msg: "foo", Data: Data{"bad": math.NaN()}}, &buf)
+	assert.Equal(t, `{"time":"2015","level":"INFO","msg":"foo","log5go_error":"json: unsupported value: NaN"}`, string(buf))
+}
+
+func Test_JsonFormatterEscapesTime(t *testing.T) {
+	var buf []byte
+	f := &jsonFormatter{timeFormat: `"2006"`}
+	f.FormatEntry(&Entry{Time: time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC), Level: LogInfo, Msg: "foo"}, &buf)
+	assert.Equal(t, `{"time":"\"2015\"","level":"INFO","msg":"foo"}`, string(buf))
+}
+
+func Test_JsonFormatterZeroAllocs(t *testing.T) {
+	f := &jsonFormatter{timeFormat: TF_GoStd, lines: true}
+	e := &Entry{Time: time.Now(), Level: LogInfo, Prefix: "prefix", Caller: "acme.go", Line: 123, Msg: "hello, world",
+		Data: Data{"str": "bar", "int": 42, "float": 3.14, "bool": true}}
+	buf := make([]byte, 0, 1024)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		buf = buf[:0]
+		f.FormatEntry(e, &buf)
+	})
+	assert.Equal(t, 0.0, allocs)
+
+	flat := &jsonFormatter{timeFormat: TF_GoStd, lines: true, schema: &JsonECSSchema}
+	allocs = testing.AllocsPerRun(100, func() {
+		buf = buf[:0]
+		flat.FormatEntry(e, &buf)
+	})
+	assert.Equal(t, 0.0, allocs)
+}
+
+func BenchmarkJsonFormatter(b *testing.B) {
+	f := &jsonFormatter{timeFormat: TF_GoStd, lines: true}
+	e := &Entry{Time: time.Now(), Level: LogInfo, Prefix: "prefix", Caller: "acme.go", Line: 123, Msg: "hello, world",
+		Data: Data{"str": "bar", "int": 42, "float": 3.14, "bool": true}}
+	buf := make([]byte, 0, 1024)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf = buf[:0]
+		f.FormatEntry(e, &buf)
+	}
+}
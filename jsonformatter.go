@@ -1,39 +1,249 @@
 package log5go
 
 import (
-	"encoding/json"
-	"fmt"
+	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 type jsonFormatter struct {
 	timeFormat string
 	lines      bool
+	schema     *JsonSchema // nil for JsonDefaultSchema
 }
 
-type jsonLog struct {
-	Time   string                 `json:"time"`
-	Level  string                 `json:"level"`
-	Prefix string                 `json:"prefix,omitempty"`
-	Line   string                 `json:"line,omitempty"`
-	Msg    string                 `json:"msg"`
-	Data   map[string]interface{} `json:"data,omitempty"`
+// JsonSchema describes the layout of JSON log messages: the key used for each
+// field, and how levels and data are rendered. A field with an empty key is left out.
+type JsonSchema struct {
+	TimeKey       string              // timestamp
+	TimeFormat    string              // time format for the timestamp. Overrides the logger's time format if set
+	LevelKey      string              // log level
+	LevelNames    map[LogLevel]string // level names. If nil, registered level strings are used. Levels missing from the map use the name of the closest level below them
+	PrefixKey     string              // logger prefix (omitted if empty)
+	LineKey       string              // caller as "file:line" (with line info)
+	FileKey       string              // caller's file (with line info)
+	LineNumKey    string              // caller's line number (with line info)
+	MsgKey        string              // message
+	ErrorKey      string              // message of the logged error, if any
+	ErrorChainKey string              // messages of the logged error and all errors it wraps
+	StackKey      string              // stack trace of the logged error, or the caller's stack
+	StackAsString bool                // render the stack trace as one multi-line string instead of an array of frames
+	DataKey       string              // object holding data
+	FlattenData   bool                // put data keys at the top level. Keys that clash with other fields are prefixed with DataKey + "."
+}
+
+// JsonDefaultSchema is the layout used by Json()
+var JsonDefaultSchema = JsonSchema{
+	TimeKey:       "time",
+	LevelKey:      "level",
+	PrefixKey:     "prefix",
+	LineKey:       "line",
+	MsgKey:        "msg",
+	ErrorKey:      "error",
+	ErrorChainKey: "error_chain",
+	StackKey:      "stacktrace",
+	DataKey:       "data",
+}
+
+// JsonECSSchema is the Elastic Common Schema layout
+var JsonECSSchema = JsonSchema{
+	TimeKey:    "@timestamp",
+	TimeFormat: "2006-01-02T15:04:05.000Z07:00",
+	LevelKey:   "log.level",
+	LevelNames: map[LogLevel]string{
+		LogAll:      "all",
+		LogTrace:    "trace",
+		LogDebug:    "debug",
+		LogInfo:     "info",
+		LogNotice:   "notice",
+		LogWarn:     "warn",
+		LogError:    "error",
+		LogCritical: "critical",
+		LogAlert:    "alert",
+		LogFatal:    "fatal",
+	},
+	PrefixKey:     "log.logger",
+	FileKey:       "log.origin.file.name",
+	LineNumKey:    "log.origin.file.line",
+	MsgKey:        "message",
+	ErrorKey:      "error.message",
+	ErrorChainKey: "error.chain",
+	StackKey:      "error.stack_trace",
+	StackAsString: true,
+	DataKey:       "labels",
+	FlattenData:   true,
+}
+
+// JsonGCPSchema is the Google Cloud Logging structured logging layout
+var JsonGCPSchema = JsonSchema{
+	TimeKey:    "time",
+	TimeFormat: time.RFC3339Nano,
+	LevelKey:   "severity",
+	LevelNames: map[LogLevel]string{
+		LogAll:      "DEFAULT",
+		LogTrace:    "DEBUG",
+		LogDebug:    "DEBUG",
+		LogInfo:     "INFO",
+		LogNotice:   "NOTICE",
+		LogWarn:     "WARNING",
+		LogError:    "ERROR",
+		LogCritical: "CRITICAL",
+		LogAlert:    "ALERT",
+		LogFatal:    "EMERGENCY",
+	},
+	PrefixKey:     "logger",
+	LineKey:       "caller",
+	MsgKey:        "message",
+	ErrorKey:      "error",
+	ErrorChainKey: "error_chain",
+	StackKey:      "stack_trace",
+	StackAsString: true,
+	DataKey:       "data",
+	FlattenData:   true,
+}
+
+// JsonDatadogSchema is the Datadog log layout, using Datadog's standard attributes
+var JsonDatadogSchema = JsonSchema{
+	TimeKey:    "timestamp",
+	TimeFormat: time.RFC3339Nano,
+	LevelKey:   "status",
+	LevelNames: map[LogLevel]string{
+		LogAll:      "debug",
+		LogTrace:    "debug",
+		LogDebug:    "debug",
+		LogInfo:     "info",
+		LogNotice:   "notice",
+		LogWarn:     "warning",
+		LogError:    "error",
+		LogCritical: "critical",
+		LogAlert:    "alert",
+		LogFatal:    "emergency",
+	},
+	PrefixKey:     "logger.name",
+	LineKey:       "caller",
+	MsgKey:        "message",
+	ErrorKey:      "error.message",
+	ErrorChainKey: "error.chain",
+	StackKey:      "error.stack",
+	StackAsString: true,
+	DataKey:       "data",
+	FlattenData:   true,
+}
+
+// levelName returns the schema's name for level
+func (s *JsonSchema) levelName(level LogLevel) string {
+	if s.LevelNames == nil {
+		return GetLogLevelString(level)
+	}
+	if name, ok := s.LevelNames[level]; ok {
+		return name
+	}
+
+	var closest LogLevel
+	var found bool
+	for l := range s.LevelNames {
+		if l < level && (!found || l > closest) {
+			closest = l
+			found = true
+		}
+	}
+	return s.LevelNames[closest]
+}
+
+// reserved returns true iff key is used by one of the schema's fields
+func (s *JsonSchema) reserved(key string) bool {
+	switch key {
+	case s.TimeKey, s.LevelKey, s.PrefixKey, s.LineKey, s.FileKey, s.LineNumKey, s.MsgKey, s.ErrorKey, s.ErrorChainKey, s.StackKey:
+		return true
+	}
+	return false
 }
 
 func (f *jsonFormatter) Format(tstamp time.Time, level LogLevel, prefix, caller string, line uint, msg string, data Data, out *[]byte) {
-	output := jsonLog{
-		Time:   tstamp.Format(f.timeFormat),
-		Level:  GetLogLevelString(level),
-		Prefix: prefix,
-		Line:   f.formatLine(caller, line),
-		Msg:    msg,
-		Data:   data,
+	f.FormatEntry(newEntry(tstamp, level, prefix, caller, line, msg, data), out)
+}
+
+func (f *jsonFormatter) FormatEntry(e *Entry, out *[]byte) {
+	s := f.schema
+	if s == nil {
+		s = &JsonDefaultSchema
+	}
+	timeFormat := f.timeFormat
+	if s.TimeFormat != "" {
+		timeFormat = s.TimeFormat
+	}
+
+	start := len(*out)
+	o := jsonObject{out: out}
+
+	o.timeField(s.TimeKey, e.Time, timeFormat)
+	o.stringField(s.LevelKey, s.levelName(e.Level))
+	if e.Prefix != "" {
+		o.stringField(s.PrefixKey, e.Prefix)
+	}
+	if f.lines && e.Caller != "" {
+		o.callerField(s.LineKey, e.Caller, e.Line)
+		o.stringField(s.FileKey, e.Caller)
+		if o.key(s.LineNumKey) {
+			*out = strconv.AppendUint(*out, uint64(e.Line), 10)
+		}
+	}
+	o.stringField(s.MsgKey, e.Msg)
+
+	errKey, err := entryError(e.Data)
+	if err != nil {
+		o.stringField(s.ErrorKey, err.Error())
+		if chain := errorChain(err); len(chain) > 1 {
+			o.stringsField(s.ErrorChainKey, chain)
+		}
+	}
+	if frames := stackFrames(entryStack(e, err)); frames != nil {
+		if s.StackAsString {
+			o.stringField(s.StackKey, strings.Join(frames, "\n"))
+		} else {
+			o.stringsField(s.StackKey, frames)
+		}
+	}
+
+	if s.FlattenData {
+		var scratch [16]string
+		for _, key := range sortedKeys(e.Data, scratch[:0]) {
+			if errKey != "" && key == errKey {
+				continue
+			}
+			if s.reserved(key) {
+				o.valueField(s.DataKey+"."+key, e.Data[key])
+			} else {
+				o.valueField(key, e.Data[key])
+			}
+		}
+	} else if len(e.Data) > 0 && (errKey == "" || len(e.Data) > 1) {
+		if o.key(s.DataKey) {
+			*out, o.err = appendJSONObject(*out, e.Data, errKey)
+		}
+	}
+
+	if o.err != nil {
+		*out = (*out)[:start]
+		f.formatFallback(e, s, timeFormat, o.err, out)
+		return
 	}
+	o.close()
+}
 
-	serialized, err := json.Marshal(output)
-	if err == nil {
-		*out = append(*out, serialized...)
+// formatFallback formats an entry whose data couldn't be encoded, so that the
+// message is still logged. The encoding error is reported in place of the data.
+func (f *jsonFormatter) formatFallback(e *Entry, s *JsonSchema, timeFormat string, err error, out *[]byte) {
+	o := jsonObject{out: out}
+	o.timeField(s.TimeKey, e.Time, timeFormat)
+	o.stringField(s.LevelKey, s.levelName(e.Level))
+	if e.Prefix != "" {
+		o.stringField(s.PrefixKey, e.Prefix)
 	}
+	o.stringField(s.MsgKey, e.Msg)
+	o.stringField("log5go_error", err.Error())
+	o.close()
 }
 
 func (f *jsonFormatter) SetTimeFormat(timeFormat string) {
@@ -44,9 +254,84 @@ func (f *jsonFormatter) SetLines(lines bool) {
 	f.lines = lines
 }
 
-func (f *jsonFormatter) formatLine(caller string, line uint) string {
-	if !f.lines || caller == "" {
-		return ""
+// jsonObject writes the fields of a JSON object, in order, to out. Fields with
+// empty keys are skipped.
+type jsonObject struct {
+	out    *[]byte
+	fields int
+	err    error
+}
+
+// key writes the key for a field, returning false if the field should be skipped
+func (o *jsonObject) key(key string) bool {
+	if key == "" || o.err != nil {
+		return false
+	}
+
+	if o.fields == 0 {
+		*o.out = append(*o.out, '{')
+	} else {
+		*o.out = append(*o.out, ',')
+	}
+	o.fields++
+
+	*o.out = appendJSONString(*o.out, key)
+	*o.out = append(*o.out, ':')
+	return true
+}
+
+func (o *jsonObject) stringField(key, value string) {
+	if o.key(key) {
+		*o.out = appendJSONString(*o.out, value)
+	}
+}
+
+func (o *jsonObject) stringsField(key string, values []string) {
+	if o.key(key) {
+		*o.out = appendJSONStrings(*o.out, values)
+	}
+}
+
+func (o *jsonObject) valueField(key string, value interface{}) {
+	if o.key(key) {
+		*o.out, o.err = appendJSONValue(*o.out, value)
+	}
+}
+
+// timeField formats t directly into the output, escaping it only if the time
+// format produced characters that need it
+func (o *jsonObject) timeField(key string, t time.Time, timeFormat string) {
+	if !o.key(key) {
+		return
+	}
+	start := len(*o.out)
+	*o.out = append(*o.out, '"')
+	*o.out = t.AppendFormat(*o.out, timeFormat)
+	for _, b := range (*o.out)[start+1:] {
+		if b < 0x20 || b == '"' || b == '\\' || b >= utf8.RuneSelf {
+			formatted := string((*o.out)[start+1:])
+			*o.out = appendJSONString((*o.out)[:start], formatted)
+			return
+		}
+	}
+	*o.out = append(*o.out, '"')
+}
+
+// callerField writes "caller:line" without building the string first
+func (o *jsonObject) callerField(key, caller string, line uint) {
+	if !o.key(key) {
+		return
+	}
+	*o.out = appendJSONString(*o.out, caller)
+	n := len(*o.out) - 1 // overwrite closing quote
+	*o.out = append((*o.out)[:n], ':')
+	*o.out = strconv.AppendUint(*o.out, uint64(line), 10)
+	*o.out = append(*o.out, '"')
+}
+
+func (o *jsonObject) close() {
+	if o.fields == 0 {
+		*o.out = append(*o.out, '{')
 	}
-	return fmt.Sprintf("%s:%d", caller, line)
+	*o.out = append(*o.out, '}')
 }
@@ -1,6 +1,9 @@
 package log5go
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"testing"
 	"time"
 )
@@ -20,3 +23,51 @@ func TestDefaultJsonFormatter(t *testing.T) {
 		t.Errorf("expected \n%s\n  but got \n%s", expected, string(buf))
 	}
 }
+
+func TestJsonSchemas(t *testing.T) {
+	theTime := time.Date(2015, 2, 7, 21, 16, 6, 0, time.UTC)
+	e := &Entry{Time: theTime, Level: LogWarn, Prefix: "db", Caller: "acme.go", Line: 123, Msg: "foo", Data: Data{"bar": "baz", "message": 1}}
+
+	var tests = []struct {
+		schema   JsonSchema
+		expected string
+	}{
+		{JsonECSSchema, `{"@timestamp":"2015-02-07T21:16:06.000Z","log.level":"warn","log.logger":"db","log.origin.file.name":"acme.go","log.origin.file.line":123,"message":"foo","bar":"baz","labels.message":1}`},
+		{JsonGCPSchema, `{"time":"2015-02-07T21:16:06Z","severity":"WARNING","logger":"db","caller":"acme.go:123","message":"foo","bar":"baz","data.message":1}`},
+		{JsonDatadogSchema, `{"timestamp":"2015-02-07T21:16:06Z","status":"warning","logger.name":"db","caller":"acme.go:123","message":"foo","bar":"baz","data.message":1}`},
+		{JsonSchema{MsgKey: "m", DataKey: "d"}, `{"m":"foo","d":{"bar":"baz","message":1}}`},
+	}
+
+	for _, test := range tests {
+		var buf []byte
+		f := &jsonFormatter{timeFormat: TF_GoStd, lines: true, schema: &test.schema}
+		f.FormatEntry(e, &buf)
+		if string(buf) != test.expected {
+			t.Errorf("expected \n%s\n  but got \n%s", test.expected, string(buf))
+		}
+	}
+}
+
+func TestJsonSchemaLevelNames(t *testing.T) {
+	audit := LogWarn + 50
+	if JsonGCPSchema.levelName(audit) != "WARNING" {
+		t.Errorf("expected custom level to map to WARNING but got %s", JsonGCPSchema.levelName(audit))
+	}
+	if JsonDefaultSchema.levelName(LogInfo) != "INFO" {
+		t.Errorf("expected registered level string but got %s", JsonDefaultSchema.levelName(LogInfo))
+	}
+}
+
+func TestJsonWithSchema(t *testing.T) {
+	var buf bytes.Buffer
+	l := Logger(LogAll).ToWriter(&buf).JsonWithSchema(JsonGCPSchema)
+	l.WithData(Err(errors.New("boom"))).Error("failed")
+
+	var out map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &out); err != nil {
+		t.Fatalf("invalid JSON %s: %v", buf.String(), err)
+	}
+	if out["severity"] != "ERROR" || out["message"] != "failed" || out["error"] != "boom" {
+		t.Errorf("unexpected output %s", buf.String())
+	}
+}
@@ -0,0 +1,59 @@
+package log5go
+
+// Lazy wraps a value that is expensive to compute. A Lazy can be passed as a format
+// argument or stored as a Data value; the function is only called when a message
+// passes the logger's threshold and is about to be formatted, e.g.
+//
+//	log.Debug("state: %v", log5go.Lazy(func() interface{} { return dump(state) }))
+//
+// The function is called once for every message that is logged, so it sees the
+// current state each time.
+type Lazy func() interface{}
+
+// resolveArgs returns args with Lazy values replaced by their results. args is
+// copied if it contains any Lazy values, so the caller's slice isn't modified.
+func resolveArgs(args []interface{}) []interface{} {
+	var resolved []interface{}
+	for i, arg := range args {
+		if fn, ok := arg.(Lazy); ok {
+			if resolved == nil {
+				resolved = make([]interface{}, len(args))
+				copy(resolved, args)
+			}
+			resolved[i] = fn.value()
+		}
+	}
+	if resolved == nil {
+		return args
+	}
+	return resolved
+}
+
+// resolveData returns data with Lazy values replaced by their results. data is
+// copied if it contains any Lazy values, so a bound logger's data stays lazy.
+func resolveData(data Data) Data {
+	var resolved Data
+	for key, value := range data {
+		if fn, ok := value.(Lazy); ok {
+			if resolved == nil {
+				resolved = make(Data, len(data))
+				for k, v := range data {
+					resolved[k] = v
+				}
+			}
+			resolved[key] = fn.value()
+		}
+	}
+	if resolved == nil {
+		return data
+	}
+	return resolved
+}
+
+// value calls fn, treating a nil Lazy as a nil value
+func (fn Lazy) value() interface{} {
+	if fn == nil {
+		return nil
+	}
+	return fn()
+}
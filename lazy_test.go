@@ -0,0 +1,88 @@
+package log5go
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLazyArgs(t *testing.T) {
+	var buf bytes.Buffer
+	l := Logger(LogInfo).ToWriter(&buf).WithFmt("%m")
+
+	calls := 0
+	expensive := Lazy(func() interface{} {
+		calls++
+		return "computed"
+	})
+
+	l.Debug("value: %v", expensive)
+	assert.Equal(t, 0, calls, "lazy argument evaluated for filtered message")
+	assert.Equal(t, "", buf.String())
+
+	args := []interface{}{expensive, 42}
+	l.Info("value: %v %d", args...)
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, "value: computed 42\n", buf.String())
+	_, stillLazy := args[0].(Lazy)
+	assert.True(t, stillLazy, "caller's arguments were modified")
+}
+
+func TestLazyData(t *testing.T) {
+	var buf bytes.Buffer
+	l := Logger(LogInfo).ToWriter(&buf).WithFmt("%m")
+
+	calls := 0
+	bl := l.WithData(Data{"n": Lazy(func() interface{} {
+		calls++
+		return calls
+	}), "plain": "x"})
+
+	bl.Debug("filtered")
+	assert.Equal(t, 0, calls, "lazy data evaluated for filtered message")
+
+	bl.Info("first")
+	bl.Info("second")
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, "first n=1 plain=\"x\"\nsecond n=2 plain=\"x\"\n", buf.String())
+}
+
+func TestLazyJsonData(t *testing.T) {
+	var buf bytes.Buffer
+	l := Logger(LogInfo).ToWriter(&buf).WithTimeFmt("").Json()
+
+	l.WithData(Data{"n": Lazy(func() interface{} { return 42 }), "nil": Lazy(nil)}).Info("hello")
+	assert.Equal(t, `{"time":"","level":"INFO","msg":"hello","data":{"n":42,"nil":null}}`, strings.TrimSpace(buf.String()))
+}
+
+func TestFnMethods(t *testing.T) {
+	var buf bytes.Buffer
+	l := Logger(LogInfo).ToWriter(&buf).WithFmt("%l %m")
+
+	calls := 0
+	fn := func() string {
+		calls++
+		return "100% done"
+	}
+
+	l.TraceFn(fn)
+	l.DebugFn(fn)
+	assert.Equal(t, 0, calls, "message function called for filtered message")
+
+	l.InfoFn(fn)
+	l.WarnFn(fn)
+	l.LogFn(LogError, fn)
+	l.WithData(Data{"k": 1}).ErrorFn(fn)
+	assert.Equal(t, 4, calls)
+	assert.Equal(t, "INFO 100% done\nWARN 100% done\nERROR 100% done\nERROR 100% done k=1\n", buf.String())
+}
+
+func TestFnMethodsReportCaller(t *testing.T) {
+	var buf bytes.Buffer
+	l := Logger(LogAll).ToWriter(&buf).WithShortLines().WithFmt("%c")
+
+	l.InfoFn(func() string { return "hello" })
+	assert.Equal(t, "lazy_test.go\n", buf.String())
+}
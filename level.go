@@ -1,6 +1,11 @@
 package log5go
 
-import "sync"
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
 
 type LogLevel uint16
 
@@ -33,10 +38,186 @@ var levelMap = map[LogLevel]string{
 	LogFatal:    "FATAL", // This level is also Syslog/EMERG
 }
 
-// Protects levelMap
+// alternative level names accepted by ParseLevel, in upper case. extensible with LevelAliases
+var levelAliases = map[string]LogLevel{
+	"WARNING":   LogWarn,
+	"ERR":       LogError,
+	"CRITICAL":  LogCritical,
+	"EMERG":     LogFatal,
+	"EMERGENCY": LogFatal,
+}
+
+// levelInfo holds optional metadata for levels created with NewLevel
+type levelInfo struct {
+	aliases     []string
+	severity    SyslogPriority
+	hasSeverity bool
+	color       Color
+	hasColor    bool
+}
+
+var levelInfos = map[LogLevel]*levelInfo{}
+
+// Protects levelMap, levelAliases and levelInfos
 var levelMapLock = new(sync.RWMutex)
 
-// RegisterLogLevel replaces a log level prefix string, or adds one for a custom log level
+// LevelOption sets optional metadata for a level created with NewLevel
+type LevelOption func(info *levelInfo)
+
+// LevelAliases sets other names that ParseLevel accepts for a level
+func LevelAliases(aliases ...string) LevelOption {
+	return func(info *levelInfo) {
+		info.aliases = append(info.aliases, aliases...)
+	}
+}
+
+// LevelSeverity sets the syslog severity of a level. By default, a custom level has the
+// severity of the closest standard level at or above it.
+func LevelSeverity(severity SyslogPriority) LevelOption {
+	return func(info *levelInfo) {
+		info.severity = severity
+		info.hasSeverity = true
+	}
+}
+
+// LevelColor sets the console color of a level, used when a logger's color palette has
+// no entry for the level. By default, a custom level has the color of the closest level below it.
+func LevelColor(color Color) LevelOption {
+	return func(info *levelInfo) {
+		info.color = color
+		info.hasColor = true
+	}
+}
+
+// NewLevel registers a custom log level. Unlike RegisterLogLevel, NewLevel returns an
+// error instead of replacing an existing level, or if name or one of its aliases is
+// already used (case-insensitively) by another level.
+func NewLevel(level LogLevel, name string, opts ...LevelOption) (LogLevel, error) {
+	if strings.TrimSpace(name) == "" {
+		return level, errors.New("log level name must not be empty")
+	}
+	info := &levelInfo{}
+	for _, opt := range opts {
+		opt(info)
+	}
+
+	levelMapLock.Lock()
+	defer levelMapLock.Unlock()
+
+	if existing, ok := levelMap[level]; ok {
+		return level, fmt.Errorf("log level %d is already registered as %s", level, existing)
+	}
+	names := append([]string{name}, info.aliases...)
+	for i, n := range names {
+		if other, ok := lookupLevel(n); ok {
+			return level, fmt.Errorf("log level name %s is already used by level %d", n, other)
+		}
+		for _, prev := range names[:i] {
+			if strings.EqualFold(n, prev) {
+				return level, fmt.Errorf("log level name %s is used twice", n)
+			}
+		}
+	}
+
+	levelMap[level] = name
+	for _, alias := range info.aliases {
+		levelAliases[strings.ToUpper(alias)] = level
+	}
+	levelInfos[level] = info
+	return level, nil
+}
+
+// LevelLogger logs messages at a single level, usually a custom one created with
+// NewLevel. It is returned by AtLevel:
+//
+//	audit := log.AtLevel(LogAudit)
+//	audit.Log("user %s changed their password", name)
+type LevelLogger interface {
+	// Log logs a message at the level
+	Log(format string, a ...interface{})
+
+	// LogFn logs the message returned by fn at the level. fn is only called if the
+	// message passes the threshold.
+	LogFn(fn func() string)
+
+	// Enabled returns whether messages at the level pass the logger's threshold
+	Enabled() bool
+}
+
+// levelLogger implements LevelLogger for a logger, or for a bound logger's data and
+// sampling policy
+type levelLogger struct {
+	l     *logger
+	bound *boundLogger // nil unless created from a bound logger
+	level LogLevel
+}
+
+func (l *levelLogger) Log(format string, a ...interface{}) {
+	if l.bound == nil {
+		l.l.log(l.level, 2, format, a, nil)
+	} else if data, ok := l.bound.sample(l.level); ok {
+		l.l.log(l.level, 2, format, a, data)
+	}
+}
+
+func (l *levelLogger) LogFn(fn func() string) {
+	if l.bound == nil {
+		l.l.logFn(l.level, 2, fn, nil)
+	} else if data, ok := l.bound.sample(l.level); ok {
+		l.l.logFn(l.level, 2, fn, data)
+	}
+}
+
+func (l *levelLogger) Enabled() bool {
+	return l.level >= l.l.LogLevel()
+}
+
+// ParseLevel returns the log level with the given name or alias, ignoring case
+func ParseLevel(name string) (LogLevel, error) {
+	levelMapLock.RLock()
+	defer levelMapLock.RUnlock()
+	if level, ok := lookupLevel(strings.TrimSpace(name)); ok {
+		return level, nil
+	}
+	return LogAll, fmt.Errorf("unknown log level %q", name)
+}
+
+// lookupLevel finds a level by name or alias. If several levels have the name, the
+// lowest one is returned. Caller must hold levelMapLock.
+func lookupLevel(name string) (level LogLevel, found bool) {
+	for l, n := range levelMap {
+		if strings.EqualFold(n, name) && (!found || l < level) {
+			level, found = l, true
+		}
+	}
+	if !found {
+		level, found = levelAliases[strings.ToUpper(name)]
+	}
+	return level, found
+}
+
+// levelSeverity returns the syslog severity set for a custom level with LevelSeverity
+func levelSeverity(level LogLevel) (SyslogPriority, bool) {
+	levelMapLock.RLock()
+	defer levelMapLock.RUnlock()
+	if info := levelInfos[level]; info != nil && info.hasSeverity {
+		return info.severity, true
+	}
+	return 0, false
+}
+
+// levelColor returns the console color set for a custom level with LevelColor
+func levelColor(level LogLevel) (Color, bool) {
+	levelMapLock.RLock()
+	defer levelMapLock.RUnlock()
+	if info := levelInfos[level]; info != nil && info.hasColor {
+		return info.color, true
+	}
+	return ColorNone, false
+}
+
+// RegisterLogLevel replaces a log level prefix string, or adds one for a custom log level.
+// Use NewLevel to add a custom level without risking replacing an existing one.
 func RegisterLogLevel(level LogLevel, prefix string) {
 	levelMapLock.Lock()
 	levelMap[level] = prefix
@@ -47,6 +228,12 @@ func RegisterLogLevel(level LogLevel, prefix string) {
 func DeregisterLogLevel(level LogLevel) {
 	levelMapLock.Lock()
 	delete(levelMap, level)
+	delete(levelInfos, level)
+	for alias, l := range levelAliases {
+		if l == level {
+			delete(levelAliases, alias)
+		}
+	}
 	levelMapLock.Unlock()
 }
 
@@ -57,15 +244,18 @@ func GetLogLevelString(level LogLevel) string {
 	return levelMap[level]
 }
 
-// LogLevelForString returns a LogLevel whose string matches the specified string.
-// Duplicate level strings will produce indeterminate results. Returns LogAll if string not found.
-func LogLevelForString(val string) LogLevel {
-	levelMapLock.Lock()
-	defer levelMapLock.Unlock()
-	for k, v := range levelMap {
-		if v == val {
-			return k
-		}
+// String returns the level's registered name, or its number if it has no name
+func (level LogLevel) String() string {
+	if name := GetLogLevelString(level); name != "" {
+		return name
 	}
-	return LogAll
+	return fmt.Sprintf("LEVEL(%d)", uint16(level))
+}
+
+// LogLevelForString returns a LogLevel whose string or alias matches the specified string,
+// ignoring case. Returns LogAll if string not found; use ParseLevel to tell an unknown
+// string apart from "ALL".
+func LogLevelForString(val string) LogLevel {
+	level, _ := ParseLevel(val)
+	return level
 }
@@ -1,6 +1,7 @@
 package log5go
 
 import (
+	"bytes"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -60,3 +61,110 @@ func Test_ShouldRegisterLogLevels(t *testing.T) {
 		t.Errorf("expected empty string but got %s", name)
 	}
 }
+
+func Test_NewLevel(t *testing.T) {
+	const logAudit LogLevel = 450
+	defer DeregisterLogLevel(logAudit)
+
+	level, err := NewLevel(logAudit, "AUDIT", LevelAliases("security"), LevelSeverity(SyslogNotice), LevelColor(ColorBlue))
+	assert.NoError(t, err)
+	assert.Equal(t, logAudit, level)
+	assert.Equal(t, "AUDIT", GetLogLevelString(logAudit))
+
+	parsed, err := ParseLevel("audit")
+	assert.NoError(t, err)
+	assert.Equal(t, logAudit, parsed)
+	parsed, err = ParseLevel("Security")
+	assert.NoError(t, err)
+	assert.Equal(t, logAudit, parsed)
+
+	assert.Equal(t, SyslogLocal0|SyslogNotice, calculatePriority(SyslogLocal0, logAudit))
+	assert.Equal(t, ColorBlue, DefaultColorPalette.ColorFor(logAudit))
+	assert.Equal(t, ColorMagenta, ColorPalette{logAudit: ColorMagenta}.ColorFor(logAudit), "palette entry should win over level color")
+
+	DeregisterLogLevel(logAudit)
+	_, err = ParseLevel("security")
+	assert.Error(t, err, "alias survived deregistration")
+	assert.Equal(t, SyslogLocal0|SyslogError, calculatePriority(SyslogLocal0, logAudit))
+}
+
+func Test_AtLevel(t *testing.T) {
+	const logAudit LogLevel = 452
+	defer DeregisterLogLevel(logAudit)
+	_, err := NewLevel(logAudit, "AUDIT")
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	l := Logger(LogWarn).ToWriter(&buf).WithFmt("%l %c %m").WithShortLines()
+	audit := l.AtLevel(logAudit)
+	assert.True(t, audit.Enabled())
+	audit.Log("user %s", "bob")
+	audit.LogFn(func() string { return "password changed" })
+	l.WithData(Data{"user": "bob"}).AtLevel(logAudit).Log("login")
+	assert.Equal(t, "AUDIT level_test.go user bob\nAUDIT level_test.go password changed\nAUDIT level_test.go login user=\"bob\"\n", buf.String())
+
+	buf.Reset()
+	assert.False(t, l.AtLevel(LogInfo).Enabled())
+	l.AtLevel(LogInfo).LogFn(func() string {
+		t.Error("fn called below the threshold")
+		return ""
+	})
+	assert.Empty(t, buf.String())
+}
+
+func Test_NewLevelConflicts(t *testing.T) {
+	const custom LogLevel = 451
+	defer DeregisterLogLevel(custom)
+
+	var tests = []struct {
+		level LogLevel
+		name  string
+		opts  []LevelOption
+	}{
+		{LogInfo, "INFO2", nil},                                   // existing level
+		{custom, "info", nil},                                     // existing name
+		{custom, "Warning", nil},                                  // existing alias
+		{custom, "CUSTOM", []LevelOption{LevelAliases("error")}},  // alias clashes with a name
+		{custom, "CUSTOM", []LevelOption{LevelAliases("custom")}}, // alias repeats the name
+		{custom, " ", nil},                                        // empty name
+	}
+
+	for _, test := range tests {
+		_, err := NewLevel(test.level, test.name, test.opts...)
+		assert.Error(t, err, "%d %s", test.level, test.name)
+	}
+	assert.Equal(t, "INFO", GetLogLevelString(LogInfo))
+	assert.Equal(t, "", GetLogLevelString(custom))
+	assert.Equal(t, 10, len(levelMap))
+}
+
+func Test_ParseLevel(t *testing.T) {
+	var tests = map[string]LogLevel{
+		"ALL":       LogAll,
+		"trace":     LogTrace,
+		" Info ":    LogInfo,
+		"WARNING":   LogWarn,
+		"warn":      LogWarn,
+		"err":       LogError,
+		"critical":  LogCritical,
+		"CRIT":      LogCritical,
+		"EMERG":     LogFatal,
+		"emergency": LogFatal,
+		"FATAL":     LogFatal,
+	}
+	for name, expected := range tests {
+		level, err := ParseLevel(name)
+		assert.NoError(t, err, name)
+		assert.Equal(t, expected, level, name)
+	}
+
+	_, err := ParseLevel("WRAN")
+	assert.Error(t, err)
+	assert.Equal(t, LogAll, LogLevelForString("WRAN"))
+	assert.Equal(t, LogWarn, LogLevelForString("warning"))
+}
+
+func Test_LevelString(t *testing.T) {
+	assert.Equal(t, "WARN", LogWarn.String())
+	assert.Equal(t, "LEVEL(451)", LogLevel(451).String())
+}
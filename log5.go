@@ -1,7 +1,9 @@
 package log5go
 
 import (
+	"crypto/tls"
 	"io"
+	"time"
 )
 
 // Log5Go is log5go's primary logging interface. All logging is performed using
@@ -37,12 +39,52 @@ type Log5Go interface {
 	// Fatal logs a message at the FATAL/EMERG log level. Note: Fatal() DOES NOT call os.Exit or panic.
 	Fatal(format string, a ...interface{})
 
+	// LogFn logs the message returned by fn at a custom log level (or explicitly at a
+	// standard log level). fn is only called if the message passes the threshold.
+	LogFn(level LogLevel, fn func() string)
+
+	// TraceFn logs the message returned by fn at the TRACE log level
+	TraceFn(fn func() string)
+
+	// DebugFn logs the message returned by fn at the DEBUG log level
+	DebugFn(fn func() string)
+
+	// InfoFn logs the message returned by fn at the INFO log level
+	InfoFn(fn func() string)
+
+	// NoticeFn logs the message returned by fn at the NOTICE log level
+	NoticeFn(fn func() string)
+
+	// WarnFn logs the message returned by fn at the WARN log level
+	WarnFn(fn func() string)
+
+	// ErrorFn logs the message returned by fn at the ERROR log level
+	ErrorFn(fn func() string)
+
+	// CriticalFn logs the message returned by fn at the CRIT log level
+	CriticalFn(fn func() string)
+
+	// AlertFn logs the message returned by fn at the ALERT log level
+	AlertFn(fn func() string)
+
+	// FatalFn logs the message returned by fn at the FATAL/EMERG log level. Like Fatal(), it DOES NOT call os.Exit or panic.
+	FatalFn(fn func() string)
+
+	// AtLevel returns a LevelLogger that logs at level, giving a custom level the same
+	// methods as the standard ones
+	AtLevel(level LogLevel) LevelLogger
+
 	// LogLevel returns the threshold that log messages must meet to be logged
 	LogLevel() LogLevel
 
 	// SetLogLevel sets the threshold that log messages must meet to be logged
 	SetLogLevel(level LogLevel)
 
+	// Flush waits up to timeout for appenders that send messages in the background (Fluent,
+	// Loki) to send the messages they hold. Call it before the program exits, or those
+	// messages are lost. Fatal() and FatalFn() flush with DefaultFlushTimeout.
+	Flush(timeout time.Duration) error
+
 	// LogBuilder contains methods for creating new logs using a builder pattern. See the LogBuilder interface for details.
 	LogBuilder
 
@@ -51,6 +93,9 @@ type Log5Go interface {
 
 	// Log5GoData contains methods for appending structured data to log messages. See interface description for details.
 	Log5GoData
+
+	// Log5GoSampling contains methods for logging only some of the calls at a call site. See interface description for details.
+	Log5GoSampling
 }
 
 // Log5GoData interface allows developers to add custom structured data to log
@@ -63,12 +108,41 @@ type Log5Go interface {
 // different formatters.
 type Log5GoData interface {
 	WithData(d Data) Log5Go
+
+	// With returns a child logger that adds fields (key/value pairs or Data maps) to
+	// every message. Unlike loggers returned by WithData(), a child logger can be
+	// configured: changing its prefix or level doesn't affect its parent.
+	With(fields ...interface{}) Log5Go
+}
+
+// Log5GoSampling interface creates loggers that only log some of the calls made at
+// each call site, e.g. to report on a retry loop without flooding the log:
+//
+//	for err := try(); err != nil; err = try() {
+//		log.Every(30 * time.Second).Warn("still retrying: %v", err)
+//	}
+//
+// Call sites are identified by the caller's file and line, so a sampled logger can
+// be created inline with each call. When calls have been skipped, the number
+// of skipped calls is added to the logged message's data under SkippedKey. Sampled
+// loggers are safe for concurrent use. Like loggers returned by WithData(), sampled
+// loggers can't be configured further.
+type Log5GoSampling interface {
+	// EveryN returns a logger that logs the first of every n calls at each call site
+	EveryN(n int) Log5Go
+
+	// Every returns a logger that logs at most one call per interval at each call site
+	Every(interval time.Duration) Log5Go
+
+	// Once returns a logger that logs only the first call at each call site
+	Once() Log5Go
 }
 
 // LogBuilder is the interface for building loggers.
 type LogBuilder interface {
 
-	// Clone returns a cloned copy of this logger
+	// Clone returns a cloned copy of this logger. Like a child logger, the clone uses
+	// this logger's appender, whose settings it can't change until it is given its own.
 	Clone() Log5Go
 
 	// WithTimeFmt sets the time format that the logger will use. Use "" for no timestamp.
@@ -89,12 +163,57 @@ type LogBuilder interface {
 	// ToAppender creates a logger that appends to a user-supplied appender.
 	ToAppender(appender Appender) Log5Go
 
+	// ToJournald creates a logger that sends messages to the systemd journal, with data as journal fields
+	ToJournald(identifier string) Log5Go
+
+	// ToGELF creates a logger that sends GELF messages to a Graylog server over UDP or TCP
+	ToGELF(transport string, addr string) Log5Go
+
+	// WithGELFCompression gzips GELF messages sent over UDP
+	WithGELFCompression(enabled bool) Log5Go
+
+	// WithGELFChunkSize sets the largest UDP datagram sent to a GELF server
+	WithGELFChunkSize(size int) Log5Go
+
+	// WithGELFWriteTimeout sets how long a write to a GELF server may take, 0 for no limit
+	WithGELFWriteTimeout(timeout time.Duration) Log5Go
+
+	// ToFluent creates a logger that sends messages to Fluentd or Fluent Bit using the forward protocol
+	ToFluent(transport string, addr string, tag string) Log5Go
+
+	// WithFluentBatch sets the size of the batches sent to a Fluent server, and how long a message may wait
+	WithFluentBatch(size int, interval time.Duration) Log5Go
+
+	// WithFluentAck makes a Fluent server acknowledge each batch, for at-least-once delivery
+	WithFluentAck(timeout time.Duration) Log5Go
+
+	// ToLoki creates a logger that pushes messages to Grafana Loki
+	ToLoki(pushURL string) Log5Go
+
+	// WithLokiLabels sends the given data keys to Loki as labels
+	WithLokiLabels(keys ...string) Log5Go
+
+	// WithLokiBatch sets the size of the batches pushed to Loki, and how long a message may wait
+	WithLokiBatch(maxBytes int, wait time.Duration) Log5Go
+
+	// WithLokiCompression gzips the requests pushed to Loki
+	WithLokiCompression(enabled bool) Log5Go
+
+	// WithAppender adds another appender. Messages go to every appender whose filters accept them.
+	WithAppender(appender Appender) Log5Go
+
 	// WithRotation sets file rotation information for a logger set to append to a file with ToFile()
 	WithRotation(frequency rollFrequency, keepNLogs int) Log5Go
 
 	// WithStderr writes all log messages at WARN or above to os.Stderr
 	WithStderr() Log5Go
 
+	// WithStderrLevel writes all log messages at or above level to os.Stderr
+	WithStderrLevel(level LogLevel) Log5Go
+
+	// WithStderrFilter writes log messages accepted by all of filters to os.Stderr
+	WithStderrFilter(filters ...Filter) Log5Go
+
 	// WithPrefix sets a custom prefix that will appear in all logged messages
 	WithPrefix(prefix string) Log5Go
 
@@ -104,12 +223,31 @@ type LogBuilder interface {
 	// WithShortLines adds partial caller info (file.go:linenum) to logged messages
 	WithShortLines() Log5Go
 
+	// WithStackTrace attaches the caller's stack trace to all messages logged at or above level
+	WithStackTrace(level LogLevel) Log5Go
+
+	// WithHook adds a hook that can modify or drop each message before it is formatted
+	WithHook(h Hook) Log5Go
+
+	// WithRedaction removes sensitive data from all messages using the given redactor
+	WithRedaction(r *Redactor) Log5Go
+
+	// WithColor colors console output by log level. Only applies when writing to a terminal.
+	WithColor() Log5Go
+
+	// WithColorPalette colors console output by log level using a custom palette
+	WithColorPalette(palette ColorPalette) Log5Go
+
 	// WithFmt sets a custom string format for log messages. See StringFormatter for details
 	WithFmt(format string) Log5Go
 
 	// Json causes all log messages to JSON-formatted.
 	Json() Log5Go
 
+	// JsonWithSchema causes all log messages to be JSON-formatted using a custom layout,
+	// e.g. JsonECSSchema, JsonGCPSchema or JsonDatadogSchema.
+	JsonWithSchema(schema JsonSchema) Log5Go
+
 	// Register registers a logger in the log5go registry, allowing it to be retrieved from anywhere in your program
 	Register(key string) Log5Go
 }
@@ -121,6 +259,38 @@ type SyslogBuilder interface {
 
 	// ToRemoteSyslog creates a logger that appends to a remote syslogd process
 	ToRemoteSyslog(facility SyslogPriority, tag string, transport string, addr string) Log5Go
+
+	// ToRemoteSyslogTLS creates a logger that appends to a remote syslogd process over TLS
+	ToRemoteSyslogTLS(facility SyslogPriority, tag string, addr string, config *tls.Config) Log5Go
+
+	// WithSyslogBacklog sets the number of messages kept while the syslog connection is down
+	WithSyslogBacklog(size int) Log5Go
+
+	// WithSyslogFallback sets the appender used while the syslog connection is down (stderr by default)
+	WithSyslogFallback(fallback Appender) Log5Go
+
+	// WithSyslogBackoff sets the minimum and maximum delays between syslog reconnection attempts
+	WithSyslogBackoff(min, max time.Duration) Log5Go
+	// WithSyslogWriteTimeout sets how long a write to syslogd may take before the connection is dropped, 0 for no limit
+	WithSyslogWriteTimeout(timeout time.Duration) Log5Go
+
+	// WithSyslogHeader sets the RFC 5424 HOSTNAME, APP-NAME, PROCID, MSGID and SD-ID of syslog messages
+	WithSyslogHeader(header SyslogHeader) Log5Go
+
+	// WithSyslogHostname selects whether HOSTNAME is the FQDN (the default), short hostname or IP
+	WithSyslogHostname(source SyslogHostname) Log5Go
+
+	// WithSyslogTime selects UTC or local syslog timestamps and their fractional precision
+	WithSyslogTime(utc bool, precision int) Log5Go
+
+	// WithSyslogProtocol selects RFC 5424 (the default) or RFC 3164 syslog messages
+	WithSyslogProtocol(protocol SyslogProtocol) Log5Go
+
+	// WithSyslogFraming selects octet-counting or newline framing on stream connections
+	WithSyslogFraming(framing SyslogFraming) Log5Go
+
+	// WithSyslogSeverity sets the mapping from log levels to syslog severities
+	WithSyslogSeverity(severity SyslogSeverityFunc) Log5Go
 }
 
 type rollFrequency uint8
@@ -5,12 +5,15 @@ import (
 	"fmt"
 	"reflect"
 	"runtime"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // Inner type of all loggers
 type logger struct {
+	// serializes appends to appenders that aren't concurrent. Child loggers use their root's
 	sync.RWMutex
 	level      LogLevel
 	formatter  Formatter
@@ -18,7 +21,18 @@ type logger struct {
 	timeFormat string
 	prefix     string
 	lines      LogLines
-	buf        []byte // buffer for holding formatted log messages
+	created    time.Time    // creation time, for reporting elapsed time
+	stacks     bool         // capture caller's stack for messages at or above stackLevel
+	stackLevel LogLevel     // threshold for capturing caller's stack
+	palette    ColorPalette // level colors for console output, nil for no colors
+	hooks      []Hook       // run on each entry before formatting
+	redactor   *Redactor    // removes sensitive data after hooks have run, nil for none
+	appenders  []Appender   // additional appenders, see WithAppender
+	fields     Data         // immutable data added to every message, see With
+	root       *logger      // for child loggers, the logger at the top of the family
+	sharedFmt  atomic.Bool  // formatter is shared with a parent, child or clone, see ownFormatter
+	sharedApp  bool         // appender belongs to the logger this one was made from, see ownAppender
+	samples    sampleSites  // call sites of sampled loggers, used by root loggers only
 }
 
 type LogLines int
@@ -41,43 +55,88 @@ var errLowLevel = errors.New("level too low")
 
 // Log a message at the given log level
 func (l *logger) Log(level LogLevel, format string, a ...interface{}) {
-	l.log(time.Now(), level, 2, fmt.Sprintf(format, a...), nil)
+	l.log(level, 2, format, a, nil)
 }
 
 func (l *logger) Trace(format string, a ...interface{}) {
-	l.log(time.Now(), LogTrace, 2, fmt.Sprintf(format, a...), nil)
+	l.log(LogTrace, 2, format, a, nil)
 }
 
 func (l *logger) Debug(format string, a ...interface{}) {
-	l.log(time.Now(), LogDebug, 2, fmt.Sprintf(format, a...), nil)
+	l.log(LogDebug, 2, format, a, nil)
 }
 
 func (l *logger) Info(format string, a ...interface{}) {
-	l.log(time.Now(), LogInfo, 2, fmt.Sprintf(format, a...), nil)
+	l.log(LogInfo, 2, format, a, nil)
 }
 
 func (l *logger) Notice(format string, a ...interface{}) {
-	l.log(time.Now(), LogNotice, 2, fmt.Sprintf(format, a...), nil)
+	l.log(LogNotice, 2, format, a, nil)
 }
 
 func (l *logger) Warn(format string, a ...interface{}) {
-	l.log(time.Now(), LogWarn, 2, fmt.Sprintf(format, a...), nil)
+	l.log(LogWarn, 2, format, a, nil)
 }
 
 func (l *logger) Error(format string, a ...interface{}) {
-	l.log(time.Now(), LogError, 2, fmt.Sprintf(format, a...), nil)
+	l.log(LogError, 2, format, a, nil)
 }
 
 func (l *logger) Critical(format string, a ...interface{}) {
-	l.log(time.Now(), LogCritical, 2, fmt.Sprintf(format, a...), nil)
+	l.log(LogCritical, 2, format, a, nil)
 }
 
 func (l *logger) Alert(format string, a ...interface{}) {
-	l.log(time.Now(), LogAlert, 2, fmt.Sprintf(format, a...), nil)
+	l.log(LogAlert, 2, format, a, nil)
 }
 
 func (l *logger) Fatal(format string, a ...interface{}) {
-	l.log(time.Now(), LogFatal, 2, fmt.Sprintf(format, a...), nil)
+	l.log(LogFatal, 2, format, a, nil)
+}
+
+// LogFn logs the message returned by fn at the given log level
+func (l *logger) LogFn(level LogLevel, fn func() string) {
+	l.logFn(level, 2, fn, nil)
+}
+
+func (l *logger) TraceFn(fn func() string) {
+	l.logFn(LogTrace, 2, fn, nil)
+}
+
+func (l *logger) DebugFn(fn func() string) {
+	l.logFn(LogDebug, 2, fn, nil)
+}
+
+func (l *logger) InfoFn(fn func() string) {
+	l.logFn(LogInfo, 2, fn, nil)
+}
+
+func (l *logger) NoticeFn(fn func() string) {
+	l.logFn(LogNotice, 2, fn, nil)
+}
+
+func (l *logger) WarnFn(fn func() string) {
+	l.logFn(LogWarn, 2, fn, nil)
+}
+
+func (l *logger) ErrorFn(fn func() string) {
+	l.logFn(LogError, 2, fn, nil)
+}
+
+func (l *logger) CriticalFn(fn func() string) {
+	l.logFn(LogCritical, 2, fn, nil)
+}
+
+func (l *logger) AlertFn(fn func() string) {
+	l.logFn(LogAlert, 2, fn, nil)
+}
+
+func (l *logger) FatalFn(fn func() string) {
+	l.logFn(LogFatal, 2, fn, nil)
+}
+
+func (l *logger) AtLevel(level LogLevel) LevelLogger {
+	return &levelLogger{l: l, level: level}
 }
 
 func (l *logger) LogLevel() LogLevel {
@@ -88,12 +147,39 @@ func (l *logger) SetLogLevel(level LogLevel) {
 	l.level = level
 }
 
+// Flush flushes the logger's appenders that are Flushers, which share the timeout
+func (l *logger) Flush(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	var err error
+	for _, a := range append([]Appender{l.appender}, l.appenders...) {
+		if f, ok := a.(Flusher); ok {
+			if ferr := f.Flush(time.Until(deadline)); err == nil {
+				err = ferr
+			}
+		}
+	}
+	return err
+}
+
+// WithData returns a bound logger that logs d with each message. d is copied, so the
+// caller may reuse it, and the bound logger can be shared by goroutines. The bound
+// logger and the copy are allocated on each call; logging through a bound logger
+// doesn't allocate, so in hot paths, bind data once and reuse the bound logger.
 func (l *logger) WithData(d Data) Log5Go {
-	return &boundLogger{l: l, data: d}
+	data := make(Data, len(d))
+	for key, value := range d {
+		data[key] = value
+	}
+	return &boundLogger{l: l, data: data}
 }
 
 func (l *logger) Json() Log5Go {
-	l.formatter = &jsonFormatter{}
+	return l.JsonWithSchema(JsonDefaultSchema)
+}
+
+func (l *logger) JsonWithSchema(schema JsonSchema) Log5Go {
+	l.formatter = &jsonFormatter{schema: &schema}
+	l.sharedFmt.Store(false)
 	l.formatter.SetTimeFormat(l.timeFormat)
 	l.formatter.SetLines(l.lines != 0)
 	return l
@@ -101,26 +187,46 @@ func (l *logger) Json() Log5Go {
 
 // log method is the actual logging implementation. It takes all data about a logging
 // event, prepares it, applies the appropriate formatter, and sends the data to the
-// configured log appender.
-func (l *logger) log(t time.Time, level LogLevel, calldepth int, msg string, data Data) error {
-	now := time.Now() // get this early.
-	var file string
-	var line int
+// configured log appender. Nothing is formatted until the level has been checked.
+func (l *logger) log(level LogLevel, calldepth int, format string, args []interface{}, data Data) error {
+	if level < l.level {
+		return errLowLevel
+	}
+	return l.write(level, calldepth+1, formatMessage(format, resolveArgs(args)), data)
+}
 
+// logFn logs the message returned by fn, which is only called if level passes
+// the logger's threshold
+func (l *logger) logFn(level LogLevel, calldepth int, fn func() string, data Data) error {
 	if level < l.level {
 		return errLowLevel
 	}
+	return l.write(level, calldepth+1, fn(), data)
+}
 
-	if l.lines != LogLinesNone {
-		// release lock while getting caller info - it's expensive.
+// write logs msg, which has passed the logger's threshold
+func (l *logger) write(level LogLevel, calldepth int, msg string, data Data) error {
+	now := time.Now() // get this early.
+	var pc uintptr
+	var file string
+	var line int
+
+	fields := requiredFields(l.formatter)
+
+	if l.lines != LogLinesNone || fields&(fieldFunc|fieldCaller) != 0 {
 		var ok bool
-		_, file, line, ok = runtime.Caller(calldepth)
+		pc, file, line, ok = caller(calldepth)
 		if !ok {
 			file = "???"
 			line = 0
 		}
 
-		if l.lines == LogLinesShort {
+		if l.lines == LogLinesNone {
+			if fields&fieldCaller == 0 {
+				file = ""
+				line = 0
+			}
+		} else if l.lines == LogLinesShort {
 			short := file
 			for i := len(file) - 1; i > 0; i-- {
 				if file[i] == '/' {
@@ -132,30 +238,190 @@ func (l *logger) log(t time.Time, level LogLevel, calldepth int, msg string, dat
 		}
 	}
 
-	data = scrubData(data)
+	ev := getEvent()
+	defer putEvent(ev)
+
+	ev.entry = Entry{
+		Time:   now,
+		Level:  level,
+		Prefix: l.prefix,
+		Caller: file,
+		Line:   uint(line),
+		Msg:    msg,
+		Data:   resolveData(l.withFields(data)),
+	}
+	entry := &ev.entry
+	if l.stacks && level >= l.stackLevel {
+		entry.Stack = callers(calldepth)
+	}
+	if fields&fieldFunc != 0 {
+		entry.Func = "???"
+		if fn := runtime.FuncForPC(pc); fn != nil {
+			entry.Func = fn.Name()
+		}
+	}
+	if fields&fieldGoroutine != 0 {
+		entry.Goroutine = goroutineID()
+	}
+	if fields&fieldElapsed != 0 {
+		entry.Elapsed = now.Sub(l.created)
+	}
+
+	if len(l.hooks) > 0 && !l.runHooks(entry) {
+		return nil
+	}
+	if l.redactor != nil {
+		l.redactor.redact(entry, len(l.hooks) > 0)
+	}
+	entry.Data = scrubData(entry.Data)
 
-	// lock buffer
-	l.Lock()
-	defer l.Unlock()
+	err := l.output(l.appender, ev)
+	for _, a := range l.appenders {
+		if aerr := l.output(a, ev); err == nil {
+			err = aerr
+		}
+	}
+	if level >= LogFatal {
+		// the program is probably about to exit, so don't leave messages in the background
+		if ferr := l.Flush(DefaultFlushTimeout); err == nil {
+			err = ferr
+		}
+	}
+	return err
+}
+
+// output formats the event's entry, if it hasn't been formatted the way appender a
+// needs it yet, and appends it to a if a's filters accept it
+func (l *logger) output(a Appender, ev *logEvent) error {
+	entry := &ev.entry
+	if !accepts(a, entry) {
+		return nil
+	}
 
-	l.buf = l.buf[:0]
-	l.formatter.Format(now, level, l.prefix, file, uint(line), msg, data, &l.buf)
+	// formatting runs in parallel, into this call's own buffers
+	buf := &ev.buf
+	if l.palette != nil && colorEnabled(a) {
+		buf = &ev.colorBuf
+		if !ev.colorFormatted {
+			entry.palette = l.palette
+			formatEntry(l.formatter, entry, buf)
+			entry.palette = nil
+			ev.colorFormatted = true
+		}
+	} else if !ev.formatted {
+		formatEntry(l.formatter, entry, buf)
+		ev.formatted = true
+	}
 
-	return l.appender.Append(&l.buf, level, now)
+	// appenders may append to msg (e.g. a newline), which must not leak to the next appender
+	ev.msg = *buf
+
+	if ca, ok := a.(ConcurrentAppender); ok && ca.Concurrent() {
+		return appendEntry(a, &ev.msg, entry)
+	}
+
+	// serialize appends
+	root := l.rootLogger()
+	root.Lock()
+	defer root.Unlock()
+
+	return appendEntry(a, &ev.msg, entry)
 }
 
-// scrubData scrubs map of any non-basic elements
+// caller is an allocation-free version of runtime.Caller
+func caller(skip int) (pc uintptr, file string, line int, ok bool) {
+	var pcs [1]uintptr
+	if runtime.Callers(skip+2, pcs[:]) < 1 {
+		return 0, "", 0, false
+	}
+	pc = pcs[0] - 1 // return address is after the call
+	fn := runtime.FuncForPC(pc)
+	if fn == nil {
+		return pc, "", 0, false
+	}
+	file, line = fn.FileLine(pc)
+	return pc, file, line, true
+}
+
+// formatMessage formats the caller's message, skipping Sprintf if there is nothing to format
+func formatMessage(format string, args []interface{}) string {
+	if len(args) == 0 && strings.IndexByte(format, '%') < 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// logEvent holds the per-message state of a log call. logEvents are pooled so that
+// log calls don't allocate. WithData itself does, see its doc.
+type logEvent struct {
+	entry          Entry
+	buf            []byte // buffer for holding the formatted log message
+	colorBuf       []byte // buffer for the message formatted with colors, for console appenders
+	formatted      bool   // buf holds the message
+	colorFormatted bool   // colorBuf holds the message
+	msg            []byte // the message as handed to an appender
+}
+
+// buffers larger than this aren't returned to the pool, so one huge message doesn't
+// pin memory forever
+const maxPooledBufferSize = 64 << 10
+
+var eventPool = sync.Pool{
+	New: func() interface{} {
+		return &logEvent{buf: make([]byte, 0, 512)}
+	},
+}
+
+func getEvent() *logEvent {
+	return eventPool.Get().(*logEvent)
+}
+
+func putEvent(ev *logEvent) {
+	if cap(ev.buf) > maxPooledBufferSize || cap(ev.colorBuf) > maxPooledBufferSize {
+		return
+	}
+	ev.entry = Entry{}
+	ev.buf = ev.buf[:0]
+	ev.colorBuf = ev.colorBuf[:0]
+	ev.msg = nil
+	ev.formatted = false
+	ev.colorFormatted = false
+	eventPool.Put(ev)
+}
+
+// scrubData scrubs map of any non-basic elements. Errors are kept so that formatters
+// can render them in detail. data isn't modified: if elements must be removed, a
+// scrubbed copy is returned.
 func scrubData(data map[string]interface{}) map[string]interface{} {
+	var scrubbed map[string]interface{}
 	for key, value := range data {
-		if value == nil {
-			continue // null values OK
+		if basicValue(value) {
+			continue
 		}
-		switch reflect.TypeOf(value).Kind() {
-		case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr, reflect.Float32, reflect.Float64, reflect.String:
-			// let it through
-		default:
-			delete(data, key)
+		if scrubbed == nil {
+			scrubbed = make(map[string]interface{}, len(data))
+			for k, v := range data {
+				scrubbed[k] = v
+			}
 		}
+		delete(scrubbed, key)
+	}
+	if scrubbed == nil {
+		return data
+	}
+	return scrubbed
+}
+
+// basicValue returns true for values that scrubData keeps
+func basicValue(value interface{}) bool {
+	// check common types first, to avoid reflection
+	switch value.(type) {
+	case nil, string, bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, uintptr, float32, float64, error, Lazy:
+		return true // null values, basic types, errors and lazy values (resolved before formatting) OK
+	}
+	switch reflect.TypeOf(value).Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr, reflect.Float32, reflect.Float64, reflect.String:
+		return true
 	}
-	return data
+	return false
 }
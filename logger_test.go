@@ -6,6 +6,7 @@ import (
 	"reflect"
 	"regexp"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -230,11 +231,34 @@ func TestScrubData(t *testing.T) {
 	var strct struct{}
 	d := Data{"badMap": badMap, "okiface": okiface, "badiface": badiface, "slice": slice, "strct": strct, "bar": "baz"}
 
-	d = scrubData(d)
+	scrubbed := scrubData(d)
 
-	if len(d) != 2 || d["bar"] != "baz" || d["okiface"] != 1 {
-		t.Errorf("expected single valid element but got: %v", d)
+	if len(scrubbed) != 2 || scrubbed["bar"] != "baz" || scrubbed["okiface"] != 1 {
+		t.Errorf("expected single valid element but got: %v", scrubbed)
 	}
+	if len(d) != 6 {
+		t.Errorf("caller's data was modified: %v", d)
+	}
+}
+
+func TestWithDataIsSafeForConcurrentUse(t *testing.T) {
+	var buf bytes.Buffer
+	d := Data{"strct": struct{}{}, "bar": "baz"}
+	bl := Logger(LogAll).ToWriter(&buf).WithFmt("%m").WithData(d)
+	d["added"] = true
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			bl.Info("hello")
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, strings.Repeat("hello bar=\"baz\"\n", 4), buf.String())
+	assert.Len(t, d, 3)
 }
 
 func runTest(log Log5Go, buf *bytes.Buffer, fmt string, t *testing.T) {
@@ -276,3 +300,46 @@ func TestGetSetLevel(t *testing.T) {
 		t.Errorf("expected %d but got %d", LogWarn, l.level)
 	}
 }
+
+func TestRequiredEntryFields(t *testing.T) {
+	var buf bytes.Buffer
+	l := Logger(LogAll).ToWriter(&buf).WithFmt("%f|%c|%g|%r")
+	l.Info("hello")
+
+	parts := strings.Split(strings.TrimSpace(buf.String()), "|")
+	if len(parts) != 4 {
+		t.Fatalf("unexpected output %s", buf.String())
+	}
+	if parts[0] != "github.com/neocortical/log5go.TestRequiredEntryFields" {
+		t.Errorf("expected caller's function but got %s", parts[0])
+	}
+	if parts[1] != "" {
+		t.Errorf("expected no caller without lines but got %s", parts[1])
+	}
+	if parts[2] == "0" || parts[2] == "" {
+		t.Errorf("expected goroutine ID but got %s", parts[2])
+	}
+	if parts[3] == "" {
+		t.Errorf("expected elapsed time but got %s", parts[3])
+	}
+}
+
+// legacyFormatter implements Formatter without FormatEntry
+type legacyFormatter struct{}
+
+func (f legacyFormatter) Format(tstamp time.Time, level LogLevel, prefix, caller string, line uint, msg string, data Data, out *[]byte) {
+	*out = append(*out, fmt.Sprintf("%s|%s|%s|%v", GetLogLevelString(level), prefix, msg, data)...)
+}
+
+func (f legacyFormatter) SetTimeFormat(timeFormat string) {}
+
+func (f legacyFormatter) SetLines(lines bool) {}
+
+func TestFormatterWithoutFormatEntry(t *testing.T) {
+	var buf bytes.Buffer
+	l := Logger(LogAll).ToWriter(&buf).WithPrefix("prefix").(*logger)
+	l.formatter = legacyFormatter{}
+	l.WithData(Data{"foo": "bar"}).Info("hello")
+
+	assert.Equal(t, "INFO|prefix|hello|map[foo:bar]\n", buf.String())
+}
@@ -0,0 +1,450 @@
+package log5go
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults for batching messages pushed to Loki
+const (
+	DefaultLokiBatchBytes = 1 << 20     // size of the lines pushed together
+	DefaultLokiBatchWait  = time.Second // maximum time a message waits for its batch to fill
+)
+
+// Defaults for retrying pushes that Loki rejected with 429 or 5xx, or that failed
+const (
+	DefaultLokiMinBackoff = 500 * time.Millisecond // delay before the first retry
+	DefaultLokiMaxBackoff = 30 * time.Second       // maximum delay between retries
+)
+
+// Loki push limits
+const (
+	lokiPushPath        = "/loki/api/v1/push"
+	lokiTimeout         = 10 * time.Second // timeout of a push request
+	maxLokiPendingBatch = 100              // batches kept while Loki is unreachable
+)
+
+// lokiStream holds the entries of a batch that have the same labels
+type lokiStream struct {
+	labels string // labels as a JSON object
+	values []byte // comma-separated ["<unix nanoseconds>", "<line>"] pairs
+}
+
+// lokiBatch is a push request that hasn't been accepted yet
+type lokiBatch struct {
+	payload    []byte
+	count      int
+	compressed bool
+}
+
+// lokiAppender pushes messages to Grafana Loki's HTTP API. Each message is labeled with
+// its level, the logger's prefix and the configured data keys; the rest of the data is
+// part of the line. Messages are pushed in batches, when the batch's lines reach the
+// batch size or its oldest message has waited for the batch wait. Pushes rejected with
+// 429 or 5xx, or that fail, are retried with exponential backoff. Pushes run in their
+// own goroutine, so logging never waits for Loki, and Flush must be called before the
+// program exits. Loki needs the entries of a stream in order, so a message that isn't
+// newer than the last message of its stream is pushed 1ns after it. Only the streams of
+// the last batch are tracked.
+type lokiAppender struct {
+	sync.Mutex
+	client      *http.Client
+	url         string
+	labels      []string // data keys sent as labels
+	compress    bool
+	batchBytes  int
+	batchWait   time.Duration
+	streams     []*lokiStream    // streams of the batch being filled
+	index       map[string]int   // index of each stream in streams, by labels
+	last        map[string]int64 // time of the last message of each stream in the last batch
+	size        int              // size of the lines in the batch being filled
+	count       int              // number of messages in the batch being filled
+	pending     []lokiBatch      // batches not accepted yet, oldest first
+	pushing     bool             // whether pending is being pushed
+	idle        chan struct{}    // closed when the pusher stops
+	dropped     int              // messages dropped from a full pending list
+	minBackoff  time.Duration
+	maxBackoff  time.Duration
+	backoff     time.Duration // current delay between retries
+	nextAttempt time.Time     // time of the next retry
+	timer       *time.Timer   // flushes the batch, or retries a push
+	buf         []byte        // buffer for the labels being written
+	zbuf        bytes.Buffer
+	zw          *gzip.Writer
+}
+
+func newLokiAppender(url string) *lokiAppender {
+	return &lokiAppender{
+		client:     &http.Client{Timeout: lokiTimeout},
+		url:        url,
+		batchBytes: DefaultLokiBatchBytes,
+		batchWait:  DefaultLokiBatchWait,
+		index:      make(map[string]int),
+		last:       make(map[string]int64),
+		minBackoff: DefaultLokiMinBackoff,
+		maxBackoff: DefaultLokiMaxBackoff,
+	}
+}
+
+func (a *lokiAppender) Append(msg *[]byte, level LogLevel, tstamp time.Time) error {
+	return a.appendEntry(msg, &Entry{Level: level, Time: tstamp})
+}
+
+// appendEntry adds msg to the stream for e's labels, pushing the batch if it is full
+func (a *lokiAppender) appendEntry(msg *[]byte, e *Entry) error {
+	a.Lock()
+	defer a.Unlock()
+
+	a.buf = a.appendLabels(a.buf[:0], e)
+	i, ok := a.index[string(a.buf)]
+	if !ok {
+		i = len(a.streams)
+		a.streams = append(a.streams, &lokiStream{labels: string(a.buf)})
+		a.index[a.streams[i].labels] = i
+	}
+	stream := a.streams[i]
+
+	// entries of a stream must be pushed in order
+	tstamp := e.Time.UnixNano()
+	if last, ok := a.last[stream.labels]; ok && tstamp <= last {
+		tstamp = last + 1
+	}
+	a.last[stream.labels] = tstamp
+
+	line := bytes.TrimRight(*msg, "\n")
+	if len(stream.values) > 0 {
+		stream.values = append(stream.values, ',')
+	}
+	stream.values = append(stream.values, '[', '"')
+	stream.values = strconv.AppendInt(stream.values, tstamp, 10)
+	stream.values = append(stream.values, '"', ',')
+	stream.values = appendJSONString(stream.values, string(line))
+	stream.values = append(stream.values, ']')
+	a.size += len(line)
+	a.count++
+
+	if a.size >= a.batchBytes {
+		a.flush()
+		return nil
+	}
+	a.scheduleFlush(a.batchWait)
+	return nil
+}
+
+// appendLabels appends e's labels as a JSON object sorted by name: level, prefix (if
+// any) and the configured data keys present in e. Caller must hold the lock.
+func (a *lokiAppender) appendLabels(buf []byte, e *Entry) []byte {
+	var scratch [16][2]string
+	labels := append(scratch[:0], [2]string{"level", strings.ToLower(GetLogLevelString(e.Level))})
+	if e.Prefix != "" {
+		labels = append(labels, [2]string{"prefix", e.Prefix})
+	}
+	for _, key := range a.labels {
+		value, ok := e.Data[key]
+		if !ok || value == nil {
+			continue
+		}
+		var s []byte
+		appendDataValue(&s, value)
+		labels = append(labels, [2]string{lokiLabelName(key), string(s)})
+	}
+	sort.Slice(labels, func(i, j int) bool { return labels[i][0] < labels[j][0] })
+
+	buf = append(buf, '{')
+	for i, label := range labels {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		buf = appendJSONString(buf, label[0])
+		buf = append(buf, ':')
+		buf = appendJSONString(buf, label[1])
+	}
+	return append(buf, '}')
+}
+
+// lokiLabelName converts a data key to a label name, which may only contain letters,
+// digits and '_' and must not start with a digit. Other characters are replaced with
+// '_'. The keys "level" and "prefix", which would clash with the level and prefix
+// labels, are sent as _level and _prefix.
+func lokiLabelName(key string) string {
+	name := make([]byte, 0, len(key)+1)
+	if key == "" || key == "level" || key == "prefix" || '0' <= key[0] && key[0] <= '9' {
+		name = append(name, '_')
+	}
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '_') {
+			c = '_'
+		}
+		name = append(name, c)
+	}
+	return string(name)
+}
+
+// scheduleFlush makes sure the batch is pushed, or a failed push retried, within delay.
+// Caller must hold the lock.
+func (a *lokiAppender) scheduleFlush(delay time.Duration) {
+	if a.timer == nil {
+		a.timer = time.AfterFunc(delay, a.timedFlush)
+	}
+}
+
+func (a *lokiAppender) timedFlush() {
+	a.Lock()
+	defer a.Unlock()
+
+	a.timer = nil
+	a.flush()
+}
+
+// flush queues the batch being filled and starts pushing the batches that haven't been
+// accepted yet, unless they are already being pushed or a retry is scheduled. Caller
+// must hold the lock.
+func (a *lokiAppender) flush() {
+	if a.count > 0 {
+		a.pending = append(a.pending, lokiBatch{payload: a.payload(), count: a.count, compressed: a.compress})
+		a.streams = a.streams[:0]
+		for labels := range a.last {
+			if _, ok := a.index[labels]; !ok {
+				delete(a.last, labels)
+			}
+		}
+		for labels := range a.index {
+			delete(a.index, labels)
+		}
+		a.size, a.count = 0, 0
+		a.trimPending()
+	}
+
+	if len(a.pending) == 0 || a.pushing {
+		return
+	}
+	if now := time.Now(); now.Before(a.nextAttempt) {
+		a.scheduleFlush(a.nextAttempt.Sub(now))
+		return
+	}
+	a.pushing = true
+	a.idle = make(chan struct{})
+	go a.pushPending()
+}
+
+// Flush queues the batch being filled and waits up to timeout for the pending batches
+// to be accepted, retrying with backoff
+func (a *lokiAppender) Flush(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	a.Lock()
+	defer a.Unlock()
+
+	for {
+		a.flush()
+		if len(a.pending) == 0 && !a.pushing {
+			return nil
+		}
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			return fmt.Errorf("Loki messages are still unsent after %v", timeout)
+		}
+
+		// wait for the pusher to stop, or for the next retry
+		var idle chan struct{}
+		if a.pushing {
+			idle = a.idle
+		} else if retry := time.Until(a.nextAttempt); retry < wait {
+			wait = retry
+		}
+		a.Unlock()
+		timer := time.NewTimer(wait)
+		select {
+		case <-idle:
+		case <-timer.C:
+		}
+		timer.Stop()
+		a.Lock()
+	}
+}
+
+// trimPending drops the oldest batches while there are too many pending. Caller must
+// hold the lock.
+func (a *lokiAppender) trimPending() {
+	for len(a.pending) > maxLokiPendingBatch {
+		a.dropped += a.pending[0].count
+		a.pending[0] = lokiBatch{}
+		a.pending = a.pending[1:]
+	}
+}
+
+// pushPending pushes the pending batches, oldest first, until they have all been
+// accepted or one has to be retried. The lock is released during each push.
+func (a *lokiAppender) pushPending() {
+	a.Lock()
+	defer a.Unlock()
+
+	for len(a.pending) > 0 {
+		batch := a.pending[0]
+		a.pending[0] = lokiBatch{}
+		a.pending = a.pending[1:]
+
+		a.Unlock()
+		retry, err := a.push(batch)
+		a.Lock()
+
+		if retry {
+			a.pending = append([]lokiBatch{batch}, a.pending...)
+			a.trimPending()
+			a.pushing = false
+			close(a.idle)
+			a.retryLater(err)
+			return
+		}
+		if err != nil {
+			reportError("Loki rejected %d messages: %v", batch.count, err)
+		}
+	}
+	a.pending = nil
+	a.pushing = false
+	close(a.idle)
+	a.backoff = 0
+
+	if a.dropped > 0 {
+		reportError("%d messages were dropped while Loki was unreachable", a.dropped)
+		a.dropped = 0
+	}
+}
+
+// payload renders the batch being filled as a push request, compressed if required.
+// Caller must hold the lock.
+func (a *lokiAppender) payload() []byte {
+	size := len(`{"streams":[]}`)
+	for _, stream := range a.streams {
+		size += len(stream.labels) + len(stream.values) + len(`{"stream":,"values":[]},`)
+	}
+	payload := make([]byte, 0, size)
+	payload = append(payload, `{"streams":[`...)
+	for i, stream := range a.streams {
+		if i > 0 {
+			payload = append(payload, ',')
+		}
+		payload = append(payload, `{"stream":`...)
+		payload = append(payload, stream.labels...)
+		payload = append(payload, `,"values":[`...)
+		payload = append(payload, stream.values...)
+		payload = append(payload, ']', '}')
+	}
+	payload = append(payload, ']', '}')
+	if !a.compress {
+		return payload
+	}
+
+	a.zbuf.Reset()
+	if a.zw == nil {
+		a.zw = gzip.NewWriter(&a.zbuf)
+	} else {
+		a.zw.Reset(&a.zbuf)
+	}
+	a.zw.Write(payload)
+	a.zw.Close()
+	return append([]byte(nil), a.zbuf.Bytes()...)
+}
+
+// push sends batch to Loki. It returns whether the push should be retried, and the
+// reason it failed. Caller must not hold the lock.
+func (a *lokiAppender) push(batch lokiBatch) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, a.url, bytes.NewReader(batch.payload))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if batch.compressed {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+
+	if resp.StatusCode/100 == 2 {
+		return false, nil
+	}
+	lerr := &lokiError{status: resp.Status, body: body}
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode/100 != 5 {
+		return false, lerr
+	}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		lerr.retryAfter = time.Duration(seconds) * time.Second
+	}
+	return true, lerr
+}
+
+// retryLater schedules another push after the current backoff, or after the delay Loki
+// asked for. Caller must hold the lock.
+func (a *lokiAppender) retryLater(err error) {
+	if a.backoff == 0 {
+		a.backoff = a.minBackoff
+	} else if a.backoff *= 2; a.backoff > a.maxBackoff {
+		a.backoff = a.maxBackoff
+	}
+	delay := a.backoff
+	if lerr, ok := err.(*lokiError); ok && lerr.retryAfter > delay {
+		delay = lerr.retryAfter
+	}
+	a.nextAttempt = time.Now().Add(delay)
+	a.scheduleFlush(delay)
+}
+
+func (a *lokiAppender) Concurrent() bool {
+	return true
+}
+
+// lokiError is an unsuccessful response from Loki
+type lokiError struct {
+	status     string
+	body       []byte
+	retryAfter time.Duration // delay asked for in Retry-After
+}
+
+func (e *lokiError) Error() string {
+	return fmt.Sprintf("%s: %s", e.status, bytes.TrimSpace(e.body))
+}
+
+// lokiFormatter formats the line pushed to Loki: the message and the data that isn't
+// sent as labels. The prefix is a label, so it's left out.
+type lokiFormatter struct {
+	syslogFormatter
+	labels []string // data keys sent as labels
+}
+
+func newLokiFormatter(lines bool) Formatter {
+	return &lokiFormatter{syslogFormatter: *newSyslogFormatter(lines).(*syslogFormatter)}
+}
+
+func (f *lokiFormatter) Format(tstamp time.Time, level LogLevel, prefix, caller string, line uint, msg string, data Data, out *[]byte) {
+	f.FormatEntry(newEntry(tstamp, level, prefix, caller, line, msg, data), out)
+}
+
+func (f *lokiFormatter) FormatEntry(e *Entry, out *[]byte) {
+	entry := *e
+	for _, key := range f.labels {
+		if _, ok := e.Data[key]; ok {
+			entry.Data = make(Data, len(e.Data))
+			for k, v := range e.Data {
+				entry.Data[k] = v
+			}
+			for _, key := range f.labels {
+				delete(entry.Data, key)
+			}
+			break
+		}
+	}
+	f.noPrefix.FormatEntry(&entry, out)
+}
@@ -0,0 +1,317 @@
+package log5go
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// lokiPush is a push request as decoded by Loki
+type lokiPush struct {
+	Streams []struct {
+		Stream map[string]string `json:"stream"`
+		Values [][2]string       `json:"values"`
+	} `json:"streams"`
+}
+
+// lokiServer is an httptest.Server standing in for Loki. Responses are taken from
+// statuses, then 204 once statuses is empty.
+type lokiServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	statuses []int
+	encoding []string
+	pushes   chan lokiPush
+}
+
+func newLokiServer(t *testing.T, statuses ...int) *lokiServer {
+	s := &lokiServer{statuses: statuses, pushes: make(chan lokiPush, 10)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != lokiPushPath {
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+
+		var body io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			body = zr
+		}
+		var push lokiPush
+		if err := json.NewDecoder(body).Decode(&push); err != nil {
+			t.Errorf("invalid push request: %v", err)
+		}
+
+		s.mu.Lock()
+		s.encoding = append(s.encoding, r.Header.Get("Content-Encoding"))
+		status := http.StatusNoContent
+		if len(s.statuses) > 0 {
+			status, s.statuses = s.statuses[0], s.statuses[1:]
+		}
+		s.mu.Unlock()
+
+		if status != http.StatusNoContent {
+			http.Error(w, "try again", status)
+			return
+		}
+		w.WriteHeader(status)
+		s.pushes <- push
+	}))
+	return s
+}
+
+func (s *lokiServer) read(t *testing.T) lokiPush {
+	select {
+	case push := <-s.pushes:
+		return push
+	case <-time.After(2 * time.Second):
+		t.Fatal("no push received")
+	}
+	return lokiPush{}
+}
+
+func TestLokiPush(t *testing.T) {
+	server := newLokiServer(t)
+	defer server.Close()
+
+	l := Logger(LogAll).ToLoki(server.URL).WithLokiBatch(1<<10, 20*time.Millisecond).WithPrefix("web").WithLokiLabels("service")
+	l.WithData(Data{"service": "auth", "user": "bob"}).Info("login")
+	l.WithData(Data{"service": "auth"}).Warn("slow request")
+	l.WithData(Data{"service": "billing"}).Info("charged")
+
+	push := server.read(t)
+	if !assert.Len(t, push.Streams, 3) {
+		return
+	}
+	assert.Equal(t, map[string]string{"level": "info", "prefix": "web", "service": "auth"}, push.Streams[0].Stream)
+	assert.Equal(t, map[string]string{"level": "warn", "prefix": "web", "service": "auth"}, push.Streams[1].Stream)
+	assert.Equal(t, map[string]string{"level": "info", "prefix": "web", "service": "billing"}, push.Streams[2].Stream)
+
+	value := push.Streams[0].Values[0]
+	assert.Equal(t, `login user="bob"`, value[1])
+	ns, err := strconv.ParseInt(value[0], 10, 64)
+	assert.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), time.Unix(0, ns), 5*time.Second)
+	assert.Equal(t, "slow request", push.Streams[1].Values[0][1])
+	assert.Equal(t, "charged", push.Streams[2].Values[0][1])
+}
+
+func TestLokiBatchSize(t *testing.T) {
+	server := newLokiServer(t)
+	defer server.Close()
+
+	l := Logger(LogAll).ToLoki(server.URL).WithLokiBatch(10, time.Minute)
+	l.Info("12345")
+	l.Info("67890")
+
+	push := server.read(t)
+	if assert.Len(t, push.Streams, 1) {
+		assert.Len(t, push.Streams[0].Values, 2)
+	}
+}
+
+func TestLokiCompression(t *testing.T) {
+	server := newLokiServer(t)
+	defer server.Close()
+
+	l := Logger(LogAll).ToLoki(server.URL).WithLokiBatch(1, time.Minute).WithLokiCompression(true)
+	l.Info("compressed")
+
+	push := server.read(t)
+	assert.Equal(t, "compressed", push.Streams[0].Values[0][1])
+	assert.Equal(t, []string{"gzip"}, server.encoding)
+}
+
+func TestLokiRetry(t *testing.T) {
+	server := newLokiServer(t, http.StatusTooManyRequests, http.StatusServiceUnavailable)
+	defer server.Close()
+
+	l := Logger(LogAll).ToLoki(server.URL).WithLokiBatch(1, time.Minute)
+	a := l.(*logger).appender.(*lokiAppender)
+	a.minBackoff = 10 * time.Millisecond
+	l.Info("eventually")
+
+	push := server.read(t)
+	assert.Equal(t, "eventually", push.Streams[0].Values[0][1])
+	assert.Len(t, server.encoding, 3)
+
+	assert.Eventually(t, func() bool {
+		a.Lock()
+		defer a.Unlock()
+		return !a.pushing
+	}, time.Second, time.Millisecond)
+	a.Lock()
+	defer a.Unlock()
+	assert.Empty(t, a.pending)
+	assert.Zero(t, a.backoff)
+}
+
+func TestLokiFlush(t *testing.T) {
+	server := newLokiServer(t, http.StatusServiceUnavailable)
+	defer server.Close()
+
+	l := Logger(LogAll).ToLoki(server.URL).WithLokiBatch(1<<20, time.Minute)
+	a := l.(*logger).appender.(*lokiAppender)
+	a.minBackoff = 10 * time.Millisecond
+	l.Info("flushed")
+	assert.NoError(t, l.Flush(time.Second))
+
+	a.Lock()
+	assert.False(t, a.pushing)
+	assert.Empty(t, a.pending)
+	a.Unlock()
+	push := server.read(t)
+	assert.Equal(t, "flushed", push.Streams[0].Values[0][1])
+}
+
+func TestLokiFlushTimesOut(t *testing.T) {
+	server := newLokiServer(t, http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable)
+	defer server.Close()
+
+	l := Logger(LogAll).ToLoki(server.URL).WithLokiBatch(1<<20, time.Minute)
+	a := l.(*logger).appender.(*lokiAppender)
+	a.minBackoff = time.Second
+	l.Info("unsent")
+
+	start := time.Now()
+	assert.Error(t, l.Flush(50*time.Millisecond))
+	assert.WithinDuration(t, start.Add(50*time.Millisecond), time.Now(), 500*time.Millisecond)
+
+	a.Lock()
+	defer a.Unlock()
+	assert.Len(t, a.pending, 1, "unsent batch was dropped")
+	if a.timer != nil {
+		a.timer.Stop()
+	}
+}
+
+func TestLokiPushDoesNotBlockLogging(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	defer close(release)
+
+	l := Logger(LogAll).ToLoki(server.URL).WithLokiBatch(1, time.Minute)
+	start := time.Now()
+	l.Info("one")
+	l.Info("two")
+	l.Info("three")
+	assert.WithinDuration(t, start, time.Now(), 500*time.Millisecond)
+}
+
+func TestLokiForgetsIdleStreams(t *testing.T) {
+	server := newLokiServer(t)
+	defer server.Close()
+
+	l := Logger(LogAll).ToLoki(server.URL).WithLokiBatch(1, time.Minute).WithLokiLabels("service")
+	a := l.(*logger).appender.(*lokiAppender)
+	l.WithData(Data{"service": "auth"}).Info("login")
+	server.read(t)
+	l.WithData(Data{"service": "billing"}).Info("charged")
+	server.read(t)
+
+	a.Lock()
+	defer a.Unlock()
+	assert.Len(t, a.last, 1)
+	_, ok := a.last[`{"level":"info","service":"billing"}`]
+	assert.True(t, ok)
+}
+
+func TestLokiRetryBackoff(t *testing.T) {
+	a := newLokiAppender("http://localhost:3100" + lokiPushPath)
+	a.minBackoff = time.Second
+	a.maxBackoff = 3 * time.Second
+	var delays []time.Duration
+	for i := 0; i < 4; i++ {
+		a.retryLater(nil)
+		delays = append(delays, a.backoff)
+	}
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second}, delays)
+
+	a.retryLater(&lokiError{retryAfter: time.Minute})
+	assert.WithinDuration(t, time.Now().Add(time.Minute), a.nextAttempt, time.Second)
+	a.timer.Stop()
+}
+
+func TestLokiDropsRejectedPushes(t *testing.T) {
+	server := newLokiServer(t, http.StatusBadRequest)
+	defer server.Close()
+
+	l := Logger(LogAll).ToLoki(server.URL).WithLokiBatch(1, time.Minute)
+	l.Info("rejected")
+	l.Info("accepted")
+
+	push := server.read(t)
+	assert.Equal(t, "accepted", push.Streams[0].Values[0][1])
+	assert.Len(t, server.encoding, 2)
+}
+
+func TestLokiStreamOrder(t *testing.T) {
+	a := newLokiAppender("http://localhost:3100" + lokiPushPath)
+	a.batchWait = time.Minute
+	tstamp := time.Unix(1700000000, 0)
+	for _, e := range []*Entry{
+		{Level: LogInfo, Time: tstamp},
+		{Level: LogInfo, Time: tstamp},
+		{Level: LogWarn, Time: tstamp},
+		{Level: LogInfo, Time: tstamp.Add(-time.Second)},
+		{Level: LogInfo, Time: tstamp.Add(time.Second)},
+	} {
+		m := []byte("x")
+		assert.NoError(t, a.appendEntry(&m, e))
+	}
+	a.timer.Stop()
+
+	var push lokiPush
+	assert.NoError(t, json.Unmarshal(a.payload(), &push))
+	if !assert.Len(t, push.Streams, 2) {
+		return
+	}
+	var times []string
+	for _, value := range push.Streams[0].Values {
+		times = append(times, value[0])
+	}
+	assert.Equal(t, []string{"1700000000000000000", "1700000000000000001", "1700000000000000002", "1700000001000000000"}, times)
+	assert.Equal(t, "1700000000000000000", push.Streams[1].Values[0][0])
+}
+
+func TestLokiLabelName(t *testing.T) {
+	var tests = map[string]string{
+		"service":    "service",
+		"request-id": "request_id",
+		"a.b c":      "a_b_c",
+		"1st":        "_1st",
+		"level":      "_level",
+		"prefix":     "_prefix",
+		"":           "_",
+	}
+	for key, expected := range tests {
+		assert.Equal(t, expected, lokiLabelName(key), key)
+	}
+}
+
+func TestLokiURL(t *testing.T) {
+	l := Logger(LogAll).ToLoki("http://localhost:3100")
+	assert.Equal(t, "http://localhost:3100"+lokiPushPath, l.(*logger).appender.(*lokiAppender).url)
+
+	l = Logger(LogAll).ToLoki("https://logs.example.com/proxy/push")
+	assert.Equal(t, "https://logs.example.com/proxy/push", l.(*logger).appender.(*lokiAppender).url)
+
+	l = Logger(LogAll).ToLoki("localhost:3100")
+	_, isLoki := l.(*logger).appender.(*lokiAppender)
+	assert.False(t, isLoki)
+}
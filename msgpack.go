@@ -0,0 +1,349 @@
+package log5go
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"time"
+)
+
+// A minimal MessagePack encoder and decoder for the Fluent forward protocol. Only the
+// types log5go sends and receives are supported.
+
+var (
+	errMsgpackShort = errors.New("msgpack: unexpected end of data")
+	errMsgpackType  = errors.New("msgpack: unsupported type")
+)
+
+func appendMsgpackNil(buf []byte) []byte {
+	return append(buf, 0xc0)
+}
+
+func appendMsgpackBool(buf []byte, b bool) []byte {
+	if b {
+		return append(buf, 0xc3)
+	}
+	return append(buf, 0xc2)
+}
+
+func appendMsgpackInt(buf []byte, i int64) []byte {
+	switch {
+	case i >= 0:
+		return appendMsgpackUint(buf, uint64(i))
+	case i >= -32:
+		return append(buf, byte(i))
+	case i >= math.MinInt8:
+		return append(buf, 0xd0, byte(i))
+	case i >= math.MinInt16:
+		return append(buf, 0xd1, byte(i>>8), byte(i))
+	case i >= math.MinInt32:
+		return append(buf, 0xd2, byte(i>>24), byte(i>>16), byte(i>>8), byte(i))
+	}
+	buf = append(buf, 0xd3)
+	return binary.BigEndian.AppendUint64(buf, uint64(i))
+}
+
+func appendMsgpackUint(buf []byte, u uint64) []byte {
+	switch {
+	case u <= 0x7f:
+		return append(buf, byte(u))
+	case u <= math.MaxUint8:
+		return append(buf, 0xcc, byte(u))
+	case u <= math.MaxUint16:
+		return append(buf, 0xcd, byte(u>>8), byte(u))
+	case u <= math.MaxUint32:
+		return append(buf, 0xce, byte(u>>24), byte(u>>16), byte(u>>8), byte(u))
+	}
+	buf = append(buf, 0xcf)
+	return binary.BigEndian.AppendUint64(buf, u)
+}
+
+func appendMsgpackFloat(buf []byte, f float64) []byte {
+	buf = append(buf, 0xcb)
+	return binary.BigEndian.AppendUint64(buf, math.Float64bits(f))
+}
+
+func appendMsgpackString(buf []byte, s string) []byte {
+	n := len(s)
+	switch {
+	case n <= 31:
+		buf = append(buf, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		buf = append(buf, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		buf = append(buf, 0xda, byte(n>>8), byte(n))
+	default:
+		buf = append(buf, 0xdb, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+	return append(buf, s...)
+}
+
+func appendMsgpackBin(buf []byte, b []byte) []byte {
+	n := len(b)
+	switch {
+	case n <= math.MaxUint8:
+		buf = append(buf, 0xc4, byte(n))
+	case n <= math.MaxUint16:
+		buf = append(buf, 0xc5, byte(n>>8), byte(n))
+	default:
+		buf = append(buf, 0xc6, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+	return append(buf, b...)
+}
+
+func appendMsgpackArrayHeader(buf []byte, n int) []byte {
+	switch {
+	case n <= 15:
+		return append(buf, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		return append(buf, 0xdc, byte(n>>8), byte(n))
+	}
+	return append(buf, 0xdd, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+}
+
+func appendMsgpackMapHeader(buf []byte, n int) []byte {
+	switch {
+	case n <= 15:
+		return append(buf, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		return append(buf, 0xde, byte(n>>8), byte(n))
+	}
+	return append(buf, 0xdf, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+}
+
+// appendMsgpackEventTime appends t as a Fluent EventTime: ext type 0 holding the seconds
+// and nanoseconds as big-endian 32-bit integers
+func appendMsgpackEventTime(buf []byte, t time.Time) []byte {
+	buf = append(buf, 0xd7, 0x00)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(t.Unix()))
+	return binary.BigEndian.AppendUint32(buf, uint32(t.Nanosecond()))
+}
+
+// appendMsgpackValue appends a data value. Basic types, []string and maps are encoded
+// natively; anything else is sent as a string, the way the text formatter renders it.
+func appendMsgpackValue(buf []byte, value interface{}) []byte {
+	switch v := value.(type) {
+	case nil:
+		return appendMsgpackNil(buf)
+	case string:
+		return appendMsgpackString(buf, v)
+	case bool:
+		return appendMsgpackBool(buf, v)
+	case int:
+		return appendMsgpackInt(buf, int64(v))
+	case int8:
+		return appendMsgpackInt(buf, int64(v))
+	case int16:
+		return appendMsgpackInt(buf, int64(v))
+	case int32:
+		return appendMsgpackInt(buf, int64(v))
+	case int64:
+		return appendMsgpackInt(buf, v)
+	case uint:
+		return appendMsgpackUint(buf, uint64(v))
+	case uint8:
+		return appendMsgpackUint(buf, uint64(v))
+	case uint16:
+		return appendMsgpackUint(buf, uint64(v))
+	case uint32:
+		return appendMsgpackUint(buf, uint64(v))
+	case uint64:
+		return appendMsgpackUint(buf, v)
+	case uintptr:
+		return appendMsgpackUint(buf, uint64(v))
+	case float32:
+		return appendMsgpackFloat(buf, float64(v))
+	case float64:
+		return appendMsgpackFloat(buf, v)
+	case error:
+		return appendMsgpackString(buf, v.Error())
+	case []string:
+		buf = appendMsgpackArrayHeader(buf, len(v))
+		for _, s := range v {
+			buf = appendMsgpackString(buf, s)
+		}
+		return buf
+	case Data:
+		return appendMsgpackMap(buf, v)
+	case map[string]interface{}:
+		return appendMsgpackMap(buf, v)
+	}
+
+	var s []byte
+	appendDataValue(&s, value)
+	return appendMsgpackString(buf, string(s))
+}
+
+func appendMsgpackMap(buf []byte, m map[string]interface{}) []byte {
+	buf = appendMsgpackMapHeader(buf, len(m))
+	var scratch [16]string
+	for _, key := range sortedKeys(m, scratch[:0]) {
+		buf = appendMsgpackString(buf, key)
+		buf = appendMsgpackValue(buf, m[key])
+	}
+	return buf
+}
+
+// decodeMsgpack decodes the first value in b, returning it and the rest of b. Maps are
+// decoded as map[string]interface{}, arrays as []interface{}, unsigned integers as
+// uint64, negative ones as int64, bin and ext data as []byte. Returns errMsgpackShort
+// if b is incomplete.
+func decodeMsgpack(b []byte) (interface{}, []byte, error) {
+	if len(b) == 0 {
+		return nil, b, errMsgpackShort
+	}
+	c := b[0]
+	b = b[1:]
+
+	switch {
+	case c <= 0x7f:
+		return uint64(c), b, nil
+	case c >= 0xe0:
+		return int64(int8(c)), b, nil
+	case c&0xe0 == 0xa0:
+		return decodeMsgpackString(b, int(c&0x1f))
+	case c&0xf0 == 0x90:
+		return decodeMsgpackArray(b, int(c&0x0f))
+	case c&0xf0 == 0x80:
+		return decodeMsgpackMap(b, int(c&0x0f))
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, b, nil
+	case 0xc2:
+		return false, b, nil
+	case 0xc3:
+		return true, b, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, b, err := decodeMsgpackLength(b, 1<<(c-0xc4))
+		if err != nil {
+			return nil, b, err
+		}
+		return decodeMsgpackBytes(b, n)
+	case 0xca:
+		u, b, err := decodeMsgpackLength(b, 4)
+		return float64(math.Float32frombits(uint32(u))), b, err
+	case 0xcb:
+		if len(b) < 8 {
+			return nil, b, errMsgpackShort
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), b[8:], nil
+	case 0xcc, 0xcd, 0xce:
+		u, b, err := decodeMsgpackLength(b, 1<<(c-0xcc))
+		return uint64(u), b, err
+	case 0xcf:
+		if len(b) < 8 {
+			return nil, b, errMsgpackShort
+		}
+		return binary.BigEndian.Uint64(b), b[8:], nil
+	case 0xd0:
+		u, b, err := decodeMsgpackLength(b, 1)
+		return int64(int8(u)), b, err
+	case 0xd1:
+		u, b, err := decodeMsgpackLength(b, 2)
+		return int64(int16(u)), b, err
+	case 0xd2:
+		u, b, err := decodeMsgpackLength(b, 4)
+		return int64(int32(u)), b, err
+	case 0xd3:
+		if len(b) < 8 {
+			return nil, b, errMsgpackShort
+		}
+		return int64(binary.BigEndian.Uint64(b)), b[8:], nil
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		// fixext: type, then 1 to 16 bytes of data
+		if len(b) < 1 {
+			return nil, b, errMsgpackShort
+		}
+		return decodeMsgpackBytes(b[1:], 1<<(c-0xd4))
+	case 0xd9, 0xda, 0xdb:
+		n, b, err := decodeMsgpackLength(b, 1<<(c-0xd9))
+		if err != nil {
+			return nil, b, err
+		}
+		return decodeMsgpackString(b, n)
+	case 0xdc, 0xdd:
+		n, b, err := decodeMsgpackLength(b, 2<<(c-0xdc))
+		if err != nil {
+			return nil, b, err
+		}
+		return decodeMsgpackArray(b, n)
+	case 0xde, 0xdf:
+		n, b, err := decodeMsgpackLength(b, 2<<(c-0xde))
+		if err != nil {
+			return nil, b, err
+		}
+		return decodeMsgpackMap(b, n)
+	}
+	return nil, b, errMsgpackType
+}
+
+// decodeMsgpackLength decodes a big-endian unsigned integer of size bytes
+func decodeMsgpackLength(b []byte, size int) (int, []byte, error) {
+	if len(b) < size {
+		return 0, b, errMsgpackShort
+	}
+	n := 0
+	for _, c := range b[:size] {
+		n = n<<8 | int(c)
+	}
+	return n, b[size:], nil
+}
+
+func decodeMsgpackString(b []byte, n int) (interface{}, []byte, error) {
+	if len(b) < n {
+		return nil, b, errMsgpackShort
+	}
+	return string(b[:n]), b[n:], nil
+}
+
+func decodeMsgpackBytes(b []byte, n int) (interface{}, []byte, error) {
+	if len(b) < n {
+		return nil, b, errMsgpackShort
+	}
+	return append([]byte(nil), b[:n]...), b[n:], nil
+}
+
+// decodeMsgpackArray decodes n values. Each takes at least a byte, so n is checked
+// against len(b) before allocating: n comes from the data, and may be up to 2^32.
+func decodeMsgpackArray(b []byte, n int) (interface{}, []byte, error) {
+	if n < 0 || n > len(b) {
+		return nil, b, errMsgpackShort
+	}
+	array := make([]interface{}, 0, n)
+	for i := 0; i < n; i++ {
+		var value interface{}
+		var err error
+		if value, b, err = decodeMsgpack(b); err != nil {
+			return nil, b, err
+		}
+		array = append(array, value)
+	}
+	return array, b, nil
+}
+
+// decodeMsgpackMap decodes n key/value pairs, checking n against len(b) like
+// decodeMsgpackArray
+func decodeMsgpackMap(b []byte, n int) (interface{}, []byte, error) {
+	if n < 0 || n > len(b)/2 {
+		return nil, b, errMsgpackShort
+	}
+	m := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		var key, value interface{}
+		var err error
+		if key, b, err = decodeMsgpack(b); err != nil {
+			return nil, b, err
+		}
+		if value, b, err = decodeMsgpack(b); err != nil {
+			return nil, b, err
+		}
+		s, ok := key.(string)
+		if !ok {
+			return nil, b, errMsgpackType
+		}
+		m[s] = value
+	}
+	return m, b, nil
+}
@@ -0,0 +1,99 @@
+package log5go
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMsgpackRoundTrip(t *testing.T) {
+	var tests = []struct {
+		value    interface{}
+		expected interface{}
+	}{
+		{nil, nil},
+		{true, true},
+		{false, false},
+		{0, uint64(0)},
+		{127, uint64(127)},
+		{128, uint64(128)},
+		{70000, uint64(70000)},
+		{uint64(math.MaxUint64), uint64(math.MaxUint64)},
+		{-1, int64(-1)},
+		{-32, int64(-32)},
+		{-33, int64(-33)},
+		{-1000, int64(-1000)},
+		{int64(math.MinInt64), int64(math.MinInt64)},
+		{float32(1.5), float64(1.5)},
+		{3.25, 3.25},
+		{"", ""},
+		{"hello", "hello"},
+		{strings.Repeat("x", 40), strings.Repeat("x", 40)},
+		{strings.Repeat("x", 300), strings.Repeat("x", 300)},
+		{strings.Repeat("x", 70000), strings.Repeat("x", 70000)},
+		{errors.New("disk full"), "disk full"},
+		{[]string{"a", "b"}, []interface{}{"a", "b"}},
+		{Data{"a": 1, "b": "c"}, map[string]interface{}{"a": uint64(1), "b": "c"}},
+		{struct{ A int }{1}, "{1}"},
+	}
+	for _, test := range tests {
+		b := appendMsgpackValue(nil, test.value)
+		decoded, rest, err := decodeMsgpack(b)
+		assert.NoError(t, err, "%v", test.value)
+		assert.Empty(t, rest, "%v", test.value)
+		assert.Equal(t, test.expected, decoded, "%v", test.value)
+	}
+}
+
+func TestMsgpackContainers(t *testing.T) {
+	b := appendMsgpackArrayHeader(nil, 20)
+	for i := 0; i < 20; i++ {
+		b = appendMsgpackInt(b, int64(i))
+	}
+	b = appendMsgpackBin(b, []byte{1, 2, 3})
+	b = appendMsgpackMapHeader(b, 0)
+
+	decoded, rest, err := decodeMsgpack(b)
+	assert.NoError(t, err)
+	assert.Len(t, decoded, 20)
+	decoded, rest, err = decodeMsgpack(rest)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{1, 2, 3}, decoded)
+	decoded, rest, err = decodeMsgpack(rest)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{}, decoded)
+	assert.Empty(t, rest)
+}
+
+func TestMsgpackEventTime(t *testing.T) {
+	tstamp := time.Unix(1700000000, 123456789)
+	b := appendMsgpackEventTime(nil, tstamp)
+	assert.Equal(t, []byte{0xd7, 0x00, 0x65, 0x53, 0xf1, 0x00, 0x07, 0x5b, 0xcd, 0x15}, b)
+}
+
+func TestMsgpackShort(t *testing.T) {
+	b := appendMsgpackMap(nil, Data{"message": "hello", "count": 3})
+	for i := 0; i < len(b); i++ {
+		_, _, err := decodeMsgpack(b[:i])
+		assert.Equal(t, errMsgpackShort, err, "%d bytes", i)
+	}
+	_, _, err := decodeMsgpack([]byte{0xc1})
+	assert.Equal(t, errMsgpackType, err)
+}
+
+func TestMsgpackHugeContainerHeaders(t *testing.T) {
+	// array32 and map32 headers claiming 2^32-1 elements, followed by a few bytes
+	for _, b := range [][]byte{
+		{0xdd, 0xff, 0xff, 0xff, 0xff, 0x01, 0x02},
+		{0xdf, 0xff, 0xff, 0xff, 0xff, 0xa1, 'a', 0x01},
+		{0xdc, 0x00, 0x03, 0x01},
+		{0xde, 0x00, 0x02, 0xa1, 'a', 0x01},
+	} {
+		_, _, err := decodeMsgpack(b)
+		assert.Equal(t, errMsgpackShort, err, "% x", b)
+	}
+}
@@ -0,0 +1,48 @@
+package log5go
+
+import (
+	"os"
+	"runtime"
+	"strconv"
+	"sync"
+)
+
+// process ID, looked up once
+var pid = os.Getpid()
+
+var hostnameOnce sync.Once
+var hostname string
+
+// processHostname returns the hostname reported by the kernel, looked up once
+func processHostname() string {
+	hostnameOnce.Do(func() {
+		host, err := os.Hostname()
+		if err != nil {
+			host = "unknown-host"
+		}
+		hostname = host
+	})
+	return hostname
+}
+
+// goroutineID parses the current goroutine's ID out of the header of its stack
+// trace ("goroutine 123 [running]:"). Returns 0 if the header can't be parsed.
+func goroutineID() uint64 {
+	var buf [64]byte
+	b := buf[:runtime.Stack(buf[:], false)]
+
+	const header = "goroutine "
+	if len(b) < len(header) || string(b[:len(header)]) != header {
+		return 0
+	}
+	b = b[len(header):]
+	end := 0
+	for end < len(b) && b[end] >= '0' && b[end] <= '9' {
+		end++
+	}
+	id, err := strconv.ParseUint(string(b[:end]), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return id
+}
@@ -0,0 +1,265 @@
+package log5go
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// RedactAction is what a redaction rule does with sensitive text
+type RedactAction int
+
+const (
+	RedactMask    RedactAction = iota // replace the text with ****
+	RedactPartial                     // keep the last few characters, e.g. ****1234
+	RedactHash                        // replace the text with a salted hash, so values can be correlated without being revealed
+)
+
+const redactMask = "****"
+
+// RedactionRule describes sensitive data to redact. A rule applies to data values whose
+// keys contain one of Keys, and to matches of Pattern in the message, in string data values
+// and in the messages of error data values and the errors they wrap.
+type RedactionRule struct {
+	Keys     []string                // data keys to redact, matched case-insensitively anywhere in the key
+	Pattern  *regexp.Regexp          // text to redact in the message and string data values
+	Validate func(match string) bool // optional check of Pattern matches. Matches failing it are left alone
+	Action   RedactAction            // what to do with the sensitive text
+	Keep     int                     // trailing characters kept by RedactPartial, 4 if zero
+}
+
+// Built-in redaction rules
+var (
+	// RuleSensitiveKeys masks data values with keys like "password", "db_secret" or "Authorization"
+	RuleSensitiveKeys = RedactionRule{
+		Keys:   []string{"password", "passwd", "secret", "authorization"},
+		Action: RedactMask,
+	}
+
+	// RuleCreditCards masks all but the last 4 digits of credit card numbers
+	RuleCreditCards = RedactionRule{
+		Pattern:  regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`),
+		Validate: luhnValid,
+		Action:   RedactPartial,
+	}
+
+	// RuleJWTs masks JSON Web Tokens
+	RuleJWTs = RedactionRule{
+		Pattern: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`),
+		Action:  RedactMask,
+	}
+
+	// RuleEmails replaces email addresses with a salted hash
+	RuleEmails = RedactionRule{
+		Pattern: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`),
+		Action:  RedactHash,
+	}
+)
+
+// DefaultRedactionRules redacts passwords, secrets, authorization headers, credit card
+// numbers, JSON Web Tokens and email addresses
+var DefaultRedactionRules = []RedactionRule{RuleSensitiveKeys, RuleCreditCards, RuleJWTs, RuleEmails}
+
+// Redactor removes sensitive data from log entries before they are formatted, so
+// that every formatter and appender gets the redacted entry. Configure a logger
+// with one using WithRedaction().
+type Redactor struct {
+	rules []RedactionRule
+	salt  []byte
+}
+
+// NewRedactor creates a redactor applying rules in order. salt keys the hashes produced
+// by RedactHash; use the same salt across processes to correlate hashed values. If salt
+// is empty, a random salt is generated.
+func NewRedactor(salt string, rules ...RedactionRule) *Redactor {
+	r := &Redactor{rules: make([]RedactionRule, len(rules)), salt: []byte(salt)}
+	for i, rule := range rules {
+		keys := make([]string, len(rule.Keys))
+		for j, key := range rule.Keys {
+			keys[j] = strings.ToLower(key)
+		}
+		rule.Keys = keys
+		if rule.Keep <= 0 {
+			rule.Keep = 4
+		}
+		r.rules[i] = rule
+	}
+	if len(r.salt) == 0 {
+		r.salt = make([]byte, 32)
+		rand.Read(r.salt)
+	}
+	return r
+}
+
+// redact redacts the entry's message and data in place. The data map is replaced
+// rather than modified, unless owned is true.
+func (r *Redactor) redact(e *Entry, owned bool) {
+	for i := range r.rules {
+		if r.rules[i].Pattern != nil {
+			e.Msg = r.redactText(&r.rules[i], e.Msg)
+		}
+	}
+
+	for key, value := range e.Data {
+		redacted := r.redactValue(key, value)
+		if redacted == value {
+			continue
+		}
+		if !owned {
+			data := make(Data, len(e.Data))
+			for k, v := range e.Data {
+				data[k] = v
+			}
+			e.Data = data
+			owned = true
+		}
+		e.Data[key] = redacted
+	}
+}
+
+// redactValue returns the redacted version of a data value
+func (r *Redactor) redactValue(key string, value interface{}) interface{} {
+	for i := range r.rules {
+		rule := &r.rules[i]
+		if value != nil && rule.matchesKey(key) {
+			return r.apply(rule, fmt.Sprint(value))
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		if redacted := r.redactString(v); redacted != v {
+			return redacted
+		}
+	case error:
+		if redacted, ok := r.redactError(v); ok {
+			return redacted
+		}
+	}
+	return value
+}
+
+// redactString applies the pattern rules to s
+func (r *Redactor) redactString(s string) string {
+	for i := range r.rules {
+		if r.rules[i].Pattern != nil {
+			s = r.redactText(&r.rules[i], s)
+		}
+	}
+	return s
+}
+
+// redactError applies the pattern rules to the messages of err and every error it
+// wraps. If any message changed, it returns a copy of the chain with redacted messages
+// and the original stack, and true.
+func (r *Redactor) redactError(err error) (error, bool) {
+	msg := err.Error()
+	redacted := &redactedError{msg: r.redactString(msg)}
+	changed := redacted.msg != msg
+
+	var inner []error
+	switch e := err.(type) {
+	case interface{ Unwrap() error }:
+		if wrapped := e.Unwrap(); wrapped != nil {
+			inner = []error{wrapped}
+		}
+	case interface{ Unwrap() []error }:
+		inner = e.Unwrap()
+	}
+	for _, wrapped := range inner {
+		w, ok := r.redactError(wrapped)
+		changed = changed || ok
+		redacted.wrapped = append(redacted.wrapped, w)
+	}
+	if !changed {
+		return err, false
+	}
+
+	if st, ok := err.(StackTracer); ok {
+		redacted.stack = st.StackTrace()
+	}
+	return redacted, true
+}
+
+// redactedError is an error chain with sensitive text redacted from its messages
+type redactedError struct {
+	msg     string
+	wrapped []error
+	stack   []uintptr
+}
+
+func (e *redactedError) Error() string         { return e.msg }
+func (e *redactedError) Unwrap() []error       { return e.wrapped }
+func (e *redactedError) StackTrace() []uintptr { return e.stack }
+
+func (rule *RedactionRule) matchesKey(key string) bool {
+	if len(rule.Keys) == 0 {
+		return false
+	}
+	key = strings.ToLower(key)
+	for _, k := range rule.Keys {
+		if strings.Contains(key, k) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Redactor) redactText(rule *RedactionRule, s string) string {
+	return rule.Pattern.ReplaceAllStringFunc(s, func(match string) string {
+		if rule.Validate != nil && !rule.Validate(match) {
+			return match
+		}
+		return r.apply(rule, match)
+	})
+}
+
+// apply returns the redacted replacement for s
+func (r *Redactor) apply(rule *RedactionRule, s string) string {
+	switch rule.Action {
+	case RedactPartial:
+		n := utf8.RuneCountInString(s)
+		if n <= rule.Keep {
+			return redactMask
+		}
+		i := len(s)
+		for k := 0; k < rule.Keep; k++ {
+			_, size := utf8.DecodeLastRuneInString(s[:i])
+			i -= size
+		}
+		return redactMask + s[i:]
+	case RedactHash:
+		mac := hmac.New(sha256.New, r.salt)
+		mac.Write([]byte(s))
+		return "sha256:" + hex.EncodeToString(mac.Sum(nil)[:8])
+	default:
+		return redactMask
+	}
+}
+
+// luhnValid returns true iff the digits in s pass the Luhn checksum used by card numbers
+func luhnValid(s string) bool {
+	sum := 0
+	double := false
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
@@ -0,0 +1,153 @@
+package log5go
+
+import (
+	"sync"
+	"time"
+)
+
+// SkippedKey is the data key holding the number of calls a sampled logger skipped
+// since it last logged a message at the same call site (see EveryN and Every)
+const SkippedKey = "skipped"
+
+type sampleMode int
+
+const (
+	sampleEveryN sampleMode = iota
+	sampleEvery
+	sampleOnce
+)
+
+// samplePolicy decides which calls of a sampled logger are logged
+type samplePolicy struct {
+	mode     sampleMode
+	n        int64
+	interval time.Duration
+}
+
+// maxSampleSites is the number of call sites a family of loggers tracks. When it is
+// exceeded, the sites' history is forgotten.
+const maxSampleSites = 4096
+
+// sampleKey identifies a call site of a sampled logger. Sites are keyed by file and
+// line rather than PC, as a function inlined in several places has several PCs.
+type sampleKey struct {
+	file   string
+	line   int
+	policy samplePolicy
+}
+
+// sampleState tracks the calls at one call site
+type sampleState struct {
+	sync.Mutex
+	calls   int64     // calls since the site was last logged
+	logged  bool      // whether the site has logged yet
+	lastLog time.Time // time the site was last logged
+}
+
+// sampleSites tracks the call sites of a family of loggers. It belongs to the root
+// logger, so child loggers created per request share their parent's sites.
+type sampleSites struct {
+	sync.Mutex
+	states map[sampleKey]*sampleState
+}
+
+// state returns the state of a call site, creating it if necessary
+func (s *sampleSites) state(key sampleKey) *sampleState {
+	s.Lock()
+	defer s.Unlock()
+
+	state := s.states[key]
+	if state == nil {
+		if s.states == nil || len(s.states) >= maxSampleSites {
+			s.states = make(map[sampleKey]*sampleState)
+		}
+		state = &sampleState{}
+		s.states[key] = state
+	}
+	return state
+}
+
+// EveryN returns a logger that logs the first of every n calls at each call site
+func (l *logger) EveryN(n int) Log5Go {
+	return &boundLogger{l: l, sampling: &samplePolicy{mode: sampleEveryN, n: int64(n)}}
+}
+
+// Every returns a logger that logs at most one call per interval at each call site
+func (l *logger) Every(interval time.Duration) Log5Go {
+	return &boundLogger{l: l, sampling: &samplePolicy{mode: sampleEvery, interval: interval}}
+}
+
+// Once returns a logger that logs only the first call at each call site
+func (l *logger) Once() Log5Go {
+	return &boundLogger{l: l, sampling: &samplePolicy{mode: sampleOnce}}
+}
+
+// sample returns true iff the current call of a sampled logger should be logged,
+// along with the data to log. Calls filtered by the logger's level aren't counted.
+// sample must be called directly from a logging method.
+func (l *boundLogger) sample(level LogLevel) (Data, bool) {
+	if l.sampling == nil {
+		return l.data, true
+	}
+	if level < l.l.level {
+		return nil, false
+	}
+
+	_, file, line, _ := caller(2) // skip sample and the logging method
+	state := l.l.rootLogger().samples.state(sampleKey{file: file, line: line, policy: *l.sampling})
+
+	skipped, ok := state.next(l.sampling, time.Now())
+	if !ok {
+		return nil, false
+	}
+	if skipped == 0 {
+		return l.data, true
+	}
+
+	data := make(Data, len(l.data)+1)
+	for k, v := range l.data {
+		data[k] = v
+	}
+	data[SkippedKey] = skipped
+	return data, true
+}
+
+// next records a call, returning true if it should be logged along with the
+// number of calls skipped since the site was last logged
+func (s *sampleState) next(p *samplePolicy, now time.Time) (skipped int64, log bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	switch {
+	case !s.logged:
+		log = true
+	case p.mode == sampleEveryN:
+		log = s.calls+1 >= p.n
+	case p.mode == sampleEvery:
+		log = now.Sub(s.lastLog) >= p.interval
+	}
+
+	if !log {
+		s.calls++
+		return 0, false
+	}
+	skipped = s.calls
+	s.calls = 0
+	s.logged = true
+	s.lastLog = now
+	return skipped, true
+}
+
+//-- sampling for bound loggers ------------
+
+func (l *boundLogger) EveryN(n int) Log5Go {
+	return &boundLogger{l: l.l, data: l.data, sampling: &samplePolicy{mode: sampleEveryN, n: int64(n)}}
+}
+
+func (l *boundLogger) Every(interval time.Duration) Log5Go {
+	return &boundLogger{l: l.l, data: l.data, sampling: &samplePolicy{mode: sampleEvery, interval: interval}}
+}
+
+func (l *boundLogger) Once() Log5Go {
+	return &boundLogger{l: l.l, data: l.data, sampling: &samplePolicy{mode: sampleOnce}}
+}
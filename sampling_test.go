@@ -0,0 +1,121 @@
+package log5go
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEveryN(t *testing.T) {
+	var buf bytes.Buffer
+	l := Logger(LogAll).ToWriter(&buf).WithFmt("%m")
+
+	for i := 0; i < 7; i++ {
+		l.EveryN(3).Info("iteration %d", i)
+	}
+	assert.Equal(t, "iteration 0\niteration 3 skipped=2\niteration 6 skipped=2\n", buf.String())
+}
+
+func TestEveryNCallSites(t *testing.T) {
+	var buf bytes.Buffer
+	l := Logger(LogAll).ToWriter(&buf).WithFmt("%m")
+
+	for i := 0; i < 2; i++ {
+		l.EveryN(2).Info("a%d", i)
+		l.EveryN(2).Info("b%d", i)
+	}
+	assert.Equal(t, "a0\nb0\n", buf.String())
+}
+
+func TestEvery(t *testing.T) {
+	var buf bytes.Buffer
+	l := Logger(LogAll).ToWriter(&buf).WithFmt("%m")
+
+	logIt := func(i int) {
+		l.Every(20*time.Millisecond).Warn("still retrying %d", i)
+	}
+	logIt(0)
+	logIt(1)
+	logIt(2)
+	time.Sleep(25 * time.Millisecond)
+	logIt(3)
+	logIt(4)
+	assert.Equal(t, "still retrying 0\nstill retrying 3 skipped=2\n", buf.String())
+}
+
+func TestOnce(t *testing.T) {
+	var buf bytes.Buffer
+	l := Logger(LogAll).ToWriter(&buf).WithFmt("%m")
+
+	for i := 0; i < 3; i++ {
+		l.Once().InfoFn(func() string { return "deprecated option used" })
+	}
+	assert.Equal(t, "deprecated option used\n", buf.String())
+}
+
+func TestSamplingIgnoresFilteredCalls(t *testing.T) {
+	var buf bytes.Buffer
+	l := Logger(LogInfo).ToWriter(&buf).WithFmt("%m")
+
+	logIt := func(level LogLevel) {
+		l.Once().Log(level, "logged")
+	}
+	logIt(LogDebug)
+	logIt(LogInfo)
+	assert.Equal(t, "logged\n", buf.String())
+}
+
+func TestSamplingWithData(t *testing.T) {
+	var buf bytes.Buffer
+	l := Logger(LogAll).ToWriter(&buf).WithFmt("%m")
+
+	d := Data{"id": 7}
+	for i := 0; i < 4; i++ {
+		l.WithData(d).EveryN(2).Info("bound")
+		l.EveryN(2).WithData(Data{"id": 8}).Info("sampled")
+	}
+	assert.Equal(t, "bound id=7\nsampled id=8\nbound id=7 skipped=1\nsampled id=8 skipped=1\n", buf.String())
+	assert.Equal(t, Data{"id": 7}, d, "caller's data was modified")
+}
+
+func TestSamplingConcurrent(t *testing.T) {
+	var buf bytes.Buffer
+	l := Logger(LogAll).ToWriter(&buf).WithFmt("%m")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				l.EveryN(10).Info("tick")
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 80, strings.Count(buf.String(), "tick"))
+}
+
+func TestSamplingChildLoggers(t *testing.T) {
+	var buf bytes.Buffer
+	l := Logger(LogAll).ToWriter(&buf).WithFmt("%m")
+
+	for i := 0; i < 4; i++ {
+		l.With("request", i).EveryN(2).Info("handled")
+	}
+	assert.Equal(t, "handled request=0\nhandled request=2 skipped=1\n", buf.String())
+	assert.Len(t, l.(*logger).samples.states, 1, "child loggers added call sites")
+}
+
+func TestSamplingSitesAreBounded(t *testing.T) {
+	var sites sampleSites
+	for i := 0; i < maxSampleSites+10; i++ {
+		sites.state(sampleKey{file: "sampling_test.go", line: i})
+	}
+	assert.True(t, len(sites.states) <= maxSampleSites, "%d call sites", len(sites.states))
+}
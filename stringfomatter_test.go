@@ -1,6 +1,9 @@
 package log5go
 
 import (
+	"fmt"
+	"os"
+	"strings"
 	"testing"
 	"time"
 )
@@ -9,9 +12,9 @@ func TestNewStringFormatter(t *testing.T) {
 	// all the stuff
 	sf := NewStringFormatter("%t %l/%L %p (%c:%n): %艾未未 %m %d %% junk %")
 
-	expected := []string{"%t", " ", "%l", "/L ", "%p", " (", "%c", ":", "%n", "): 艾未未 ", "%m", " d ", "%%", " junk "}
+	expected := []string{"%t", " ", "%l", "/L ", "%p", " (", "%c", ":", "%n", "): 艾未未 ", "%m", " ", "%d", " ", "%%", " junk "}
 
-	if !testEq(sf.parts, expected) {
+	if !testEq(partStrings(sf.parts), expected) {
 		t.Errorf("expected \n%v, but got \n%v", expected, sf.parts)
 	}
 
@@ -20,7 +23,7 @@ func TestNewStringFormatter(t *testing.T) {
 
 	expected = []string{}
 
-	if !testEq(sf.parts, expected) {
+	if !testEq(partStrings(sf.parts), expected) {
 		t.Errorf("expected \n%v, but got \n%v", expected, sf.parts)
 	}
 }
@@ -63,6 +66,117 @@ func TestDataAppend(t *testing.T) {
 	}
 }
 
+func TestNewStringFormatterExtendedVerbs(t *testing.T) {
+	sf := NewStringFormatter("%f %P %H %g %r %d %{user id}%{unterminated")
+
+	expected := []string{"%f", " ", "%P", " ", "%H", " ", "%g", " ", "%r", " ", "%d", " ", "%{user id}", "{unterminated"}
+	if !testEq(partStrings(sf.parts), expected) {
+		t.Errorf("expected \n%v, but got \n%v", expected, sf.parts)
+	}
+	if sf.fields != fieldFunc|fieldGoroutine|fieldElapsed || !sf.dataPart {
+		t.Errorf("unexpected required fields %d (data: %v)", sf.fields, sf.dataPart)
+	}
+
+	// unused verbs require nothing
+	sf = NewStringFormatter(FMT_DefaultPrefixLines)
+	if sf.fields != 0 || sf.dataPart {
+		t.Errorf("expected no required fields but got %d (data: %v)", sf.fields, sf.dataPart)
+	}
+}
+
+func TestStringFormatterExtendedVerbs(t *testing.T) {
+	var buf []byte
+	e := &Entry{
+		Level:     LogInfo,
+		Msg:       "hello?",
+		Data:      Data{"foo": "bar", "n": 42},
+		Func:      "main.main",
+		Goroutine: 7,
+		Elapsed:   1500 * time.Millisecond,
+	}
+
+	sf := NewStringFormatter("%f %P %H %g %r [%{foo}|%{n}|%{missing}] %m")
+	sf.FormatEntry(e, &buf)
+	expected := fmt.Sprintf("main.main %d %s 7 1500 [bar|42|] hello? ", os.Getpid(), processHostname())
+	if !strings.HasPrefix(string(buf), expected) {
+		t.Errorf("expected %s but got %s", expected, string(buf))
+	}
+
+	// %d moves data out of %m
+	buf = buf[:0]
+	sf = NewStringFormatter("%m {%d}")
+	sf.FormatEntry(e, &buf)
+	if string(buf) != "hello? {foo=\"bar\" n=42}" && string(buf) != "hello? {n=42 foo=\"bar\"}" {
+		t.Errorf("unexpected output %s", string(buf))
+	}
+}
+
+func TestDecodeModifiers(t *testing.T) {
+	sf := NewStringFormatter("%-5l|%20.30c|%.-1000m|%^-8p|%_{key}|%-x|%5")
+
+	expected := []string{"%-5l", "|", "%20.30c", "|", "%.-1000m", "|", "%-^8p", "|", "%_{key}", "|-x|5"}
+	if !testEq(partStrings(sf.parts), expected) {
+		t.Errorf("expected \n%v, but got \n%v", expected, partStrings(sf.parts))
+	}
+
+	p := sf.parts[2]
+	if p.verb != 'c' || p.minWidth != 20 || p.maxWidth != 30 || p.leftAlign || p.truncEnd {
+		t.Errorf("unexpected compiled part %#v", p)
+	}
+}
+
+func TestStringFormatterModifiers(t *testing.T) {
+	e := &Entry{Level: LogInfo, Prefix: "Prefix", Caller: "acme.go", Line: 123, Msg: "艾未未 hello, world", Data: Data{"key": "VALUE"}}
+
+	var tests = []struct {
+		pattern  string
+		expected string
+	}{
+		{"[%-5l]", "[INFO ]"},
+		{"[%5l]", "[ INFO]"},
+		{"[%3l]", "[INFO]"},
+		{"[%12c:%-5n]", "[     acme.go:123  ]"},
+		{"[%.4c]", "[e.go]"},
+		{"[%.-4c]", "[acme]"},
+		{"[%.-5m]", "[艾未未 h]"},
+		{"[%.5m] %d", "[world] key=\"VALUE\""},
+		{"[%-8.-2m]", "[艾未      ]"},
+		{"[%^p %_p %_{key}]", "[PREFIX prefix value]"},
+		{"[%^-8p]", "[PREFIX  ]"},
+	}
+
+	for _, test := range tests {
+		var buf []byte
+		NewStringFormatter(test.pattern).FormatEntry(e, &buf)
+		if string(buf) != test.expected {
+			t.Errorf("pattern %s: expected %s but got %s", test.pattern, test.expected, string(buf))
+		}
+	}
+}
+
+// %.N keeps the end of a message, as in Log4j; %.-N keeps its start
+func TestStringFormatterTruncatesMessage(t *testing.T) {
+	long := &Entry{Level: LogInfo, Msg: "start " + strings.Repeat("x", 20) + " end"}
+	var buf []byte
+	NewStringFormatter("%.-9m").FormatEntry(long, &buf)
+	if string(buf) != "start xxx" {
+		t.Errorf("%%.-9m should keep the start of the message but got %s", buf)
+	}
+	buf = buf[:0]
+	NewStringFormatter("%.9m").FormatEntry(long, &buf)
+	if string(buf) != "xxxxx end" {
+		t.Errorf("%%.9m should keep the end of the message but got %s", buf)
+	}
+}
+
+func partStrings(parts []patternPart) (result []string) {
+	result = []string{}
+	for _, part := range parts {
+		result = append(result, part.String())
+	}
+	return result
+}
+
 func testEq(a, b []string) bool {
 	if len(a) != len(b) {
 		return false
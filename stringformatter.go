@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 	"unicode/utf8"
 )
@@ -16,26 +17,131 @@ import (
 // %p - user-supplied prefix
 // %c - caller (if line info present)
 // %n - line number (if line info present)
-// %m - caller-supplied log message
+// %m - caller-supplied log message (followed by data, unless %d is used)
+// %f - caller's function name
+// %P - process ID
+// %H - hostname
+// %g - goroutine ID
+// %r - milliseconds elapsed since the logger was created
+// %d - caller-supplied data, as key=value pairs
+// %{key} - a single data value
+// %[color] - switch color: %[red], %[bold], %[1;35], %[level] (level's color), %[] (reset)
+//
 // %% - literal percent sign
 //
+// Any meta-pattern can carry Log4j-style modifiers between the % and the pattern
+// letter, e.g. %-5l or %20.30c:
+//
+// -   - left-align (pad on the right) when padding to the minimum width
+// ^   - convert to upper case
+// _   - convert to lower case
+// N   - minimum width. Shorter values are padded with spaces (on the left by default)
+// .N  - maximum width. Longer values keep their last N characters, as in Log4j
+// .-N - maximum width. Longer values keep their first N characters
+//
+// Note that %.1000m drops the beginning of a long message; use %.-1000m to cap a
+// message's length and keep its start.
+//
+// Widths are counted in characters (runes), not bytes. Modifiers are parsed once,
+// when the pattern is decoded.
+//
+// Colors are only rendered for loggers configured WithColor() that write to a
+// terminal; otherwise %[color] spans render as nothing. If colors are enabled and
+// the pattern has no %[color] spans, each line is rendered in its level's color.
+//
 // Single occurrences of % will be discarded. Be sure to include %m somewhere or
 // your message won't get logged!
 type StringFormatter struct {
-	parts          []string
+	parts          []patternPart
 	explicitFormat bool
 	timeFormat     string
+	fields         entryFields // optional Entry fields used by parts
+	dataPart       bool        // parts contain %d, so %m doesn't render data
+	colorSpans     bool        // parts contain %[color] spans
+}
+
+// patternPart is a compiled piece of a StringFormatter pattern: either literal
+// text or a meta-pattern with its modifiers.
+type patternPart struct {
+	verb      byte   // meta-pattern letter, or 0 for literal text
+	text      string // literal text, or the key of a %{key} meta-pattern, or the name of a %[color] span
+	color     Color  // color of a %[color] span
+	leftAlign bool   // pad on the right instead of the left
+	textCase  byte   // '^' for upper case, '_' for lower case, 0 to leave as-is
+	minWidth  int    // pad to at least this many runes
+	maxWidth  int    // truncate to at most this many runes, 0 for no limit
+	truncEnd  bool   // truncate from the end instead of the beginning
+}
+
+// modified returns true iff the part has any modifiers to apply after rendering
+func (p patternPart) modified() bool {
+	return p.textCase != 0 || p.minWidth > 0 || p.maxWidth > 0
+}
+
+// String returns the pattern notation for the part
+func (p patternPart) String() string {
+	if p.verb == 0 {
+		return p.text
+	}
+
+	result := []byte{'%'}
+	if p.leftAlign {
+		result = append(result, '-')
+	}
+	if p.textCase != 0 {
+		result = append(result, p.textCase)
+	}
+	if p.minWidth > 0 {
+		result = strconv.AppendInt(result, int64(p.minWidth), 10)
+	}
+	if p.maxWidth > 0 {
+		result = append(result, '.')
+		if p.truncEnd {
+			result = append(result, '-')
+		}
+		result = strconv.AppendInt(result, int64(p.maxWidth), 10)
+	}
+	if p.verb == '{' {
+		return string(result) + "{" + p.text + "}"
+	}
+	if p.verb == '[' {
+		return string(result) + "[" + p.text + "]"
+	}
+	return string(append(result, p.verb))
 }
 
 func NewStringFormatter(pattern string) (sf *StringFormatter) {
 	sf = &StringFormatter{timeFormat: TF_GoStd}
 
-	sf.parts = decodePattern(pattern)
+	sf.setPattern(pattern)
 
 	return sf
 }
 
-func decodePattern(pattern string) (result []string) {
+// setPattern decodes pattern and works out what the resulting parts will need at log time
+func (f *StringFormatter) setPattern(pattern string) {
+	f.parts = decodePattern(pattern)
+	f.fields = 0
+	f.dataPart = false
+	f.colorSpans = false
+
+	for _, part := range f.parts {
+		switch part.verb {
+		case 'f':
+			f.fields |= fieldFunc
+		case 'g':
+			f.fields |= fieldGoroutine
+		case 'r':
+			f.fields |= fieldElapsed
+		case 'd':
+			f.dataPart = true
+		case '[':
+			f.colorSpans = true
+		}
+	}
+}
+
+func decodePattern(pattern string) (result []patternPart) {
 	var buf []byte
 	r := make([]byte, 4)
 	for len(pattern) > 0 {
@@ -48,19 +154,53 @@ func decodePattern(pattern string) (result []string) {
 		// intercept meta-pattern. ignore % if meta-pattern is illegal
 		if runeValue == '%' {
 
-			// collect the meta-pattern
-			meta, width := utf8.DecodeRuneInString(pattern)
+			// collect modifiers, then the meta-pattern
+			part, rest := decodeModifiers(pattern)
+			meta, width := utf8.DecodeRuneInString(rest)
 			switch meta {
-			case '%', 't', 'l', 'p', 'c', 'n', 'm':
+			case '%', 't', 'l', 'p', 'c', 'n', 'm', 'f', 'P', 'H', 'g', 'r', 'd':
 				// valid meta-pattern detected. dump any collected literal pattern first
 				// dump any literal value we have collected
 				if len(buf) > 0 {
-					result = append(result, string(buf))
+					result = append(result, patternPart{text: string(buf)})
 					buf = buf[:0]
 				}
 
-				result = append(result, "%"+string(meta&0xff)) // all metas are ascii
-				pattern = pattern[width:]
+				part.verb = byte(meta) // all metas are ascii
+				result = append(result, part)
+				pattern = rest[width:]
+			case '{':
+				// data key meta-pattern. only valid if the key is terminated
+				end := strings.IndexRune(rest, '}')
+				if end < 0 {
+					continue
+				}
+				if len(buf) > 0 {
+					result = append(result, patternPart{text: string(buf)})
+					buf = buf[:0]
+				}
+
+				part.verb = '{'
+				part.text = rest[1:end]
+				result = append(result, part)
+				pattern = rest[end+1:]
+			case '[':
+				// color span. only valid if terminated and the color is known
+				end := strings.IndexRune(rest, ']')
+				if end < 0 {
+					continue
+				}
+				color, ok := parseColor(rest[1:end])
+				if !ok {
+					continue
+				}
+				if len(buf) > 0 {
+					result = append(result, patternPart{text: string(buf)})
+					buf = buf[:0]
+				}
+
+				result = append(result, patternPart{verb: '[', text: rest[1:end], color: color})
+				pattern = rest[end+1:]
 			}
 		} else {
 			utf8.EncodeRune(r, runeValue)
@@ -69,40 +209,190 @@ func decodePattern(pattern string) (result []string) {
 	}
 
 	if len(buf) > 0 {
-		result = append(result, string(buf))
+		result = append(result, patternPart{text: string(buf)})
 	}
 
 	return result
 }
 
+// decodeModifiers parses any modifiers at the start of pattern, returning them
+// along with the remainder of the pattern
+func decodeModifiers(pattern string) (part patternPart, rest string) {
+	i := 0
+	for ; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '-':
+			part.leftAlign = true
+			continue
+		case '^', '_':
+			part.textCase = pattern[i]
+			continue
+		}
+		break
+	}
+
+	part.minWidth, i = decodeWidth(pattern, i)
+
+	if i < len(pattern) && pattern[i] == '.' {
+		i++
+		if i < len(pattern) && pattern[i] == '-' {
+			part.truncEnd = true
+			i++
+		}
+		part.maxWidth, i = decodeWidth(pattern, i)
+	}
+
+	return part, pattern[i:]
+}
+
+func decodeWidth(pattern string, i int) (width int, next int) {
+	for ; i < len(pattern) && pattern[i] >= '0' && pattern[i] <= '9'; i++ {
+		width = width*10 + int(pattern[i]-'0')
+	}
+	return width, i
+}
+
 func (f *StringFormatter) Format(tstamp time.Time, level LogLevel, prefix, caller string, line uint, msg string, data Data, buf *[]byte) {
+	f.FormatEntry(newEntry(tstamp, level, prefix, caller, line, msg, data), buf)
+}
+
+func (f *StringFormatter) FormatEntry(e *Entry, buf *[]byte) {
+	errKey, err := entryError(e.Data)
+
+	// color whole line by level, unless the pattern places colors itself
+	var lineColor Color
+	if e.palette != nil && !f.colorSpans {
+		lineColor = e.palette.ColorFor(e.Level)
+		if lineColor != ColorNone {
+			appendColor(buf, lineColor)
+		}
+	}
+	colored := false
+
 	for _, part := range f.parts {
-		switch part {
-		case "%t":
-			timeString := tstamp.Format(f.timeFormat)
-			*buf = append(*buf, timeString...)
-		case "%l":
-			levelString := GetLogLevelString(level)
+		start := len(*buf)
+
+		switch part.verb {
+		case 0:
+			*buf = append(*buf, part.text...)
+		case 't':
+			*buf = e.Time.AppendFormat(*buf, f.timeFormat)
+		case 'l':
+			levelString := GetLogLevelString(e.Level)
 			*buf = append(*buf, levelString...)
-		case "%p":
-			*buf = append(*buf, prefix...)
-		case "%c":
-			*buf = append(*buf, caller...)
-		case "%n":
-			*buf = append(*buf, strconv.FormatUint(uint64(line), 10)...)
-		case "%m":
-			if data != nil {
-				msg = appendData(msg, data)
+		case 'p':
+			*buf = append(*buf, e.Prefix...)
+		case 'c':
+			*buf = append(*buf, e.Caller...)
+		case 'n':
+			*buf = strconv.AppendUint(*buf, uint64(e.Line), 10)
+		case 'm':
+			*buf = append(*buf, e.Msg...)
+			if e.Data != nil && !f.dataPart {
+				appendData(buf, e.Data, errKey)
 			}
-			*buf = append(*buf, msg...)
-		case "%%":
+		case 'f':
+			*buf = append(*buf, e.Func...)
+		case 'P':
+			*buf = strconv.AppendInt(*buf, int64(pid), 10)
+		case 'H':
+			*buf = append(*buf, processHostname()...)
+		case 'g':
+			*buf = strconv.AppendUint(*buf, e.Goroutine, 10)
+		case 'r':
+			*buf = strconv.AppendInt(*buf, int64(e.Elapsed/time.Millisecond), 10)
+		case 'd':
+			appendData(buf, e.Data, errKey)
+			if len(*buf) > start {
+				// drop leading space
+				copy((*buf)[start:], (*buf)[start+1:])
+				*buf = (*buf)[:len(*buf)-1]
+			}
+		case '{':
+			appendDataValue(buf, e.Data[part.text])
+		case '[':
+			if e.palette != nil {
+				color := part.color
+				if part.text == "level" {
+					color = e.palette.ColorFor(e.Level)
+				}
+				if color != ColorNone {
+					appendColor(buf, color)
+					colored = color != ColorReset
+				}
+			}
+			continue // modifiers don't apply to color spans
+		case '%':
 			*buf = append(*buf, '%')
-		default:
-			*buf = append(*buf, part...)
+		}
+
+		if part.modified() {
+			applyModifiers(buf, start, part)
+		}
+	}
+
+	appendErrorBlock(buf, err, entryStack(e, err))
+
+	if colored || lineColor != ColorNone {
+		appendColor(buf, ColorReset)
+	}
+}
+
+// applyModifiers applies part's case, truncation and padding modifiers to the
+// text rendered for it, which starts at (*buf)[start]
+func applyModifiers(buf *[]byte, start int, part patternPart) {
+	value := (*buf)[start:]
+
+	switch part.textCase {
+	case '^':
+		value = bytes.ToUpper(value)
+	case '_':
+		value = bytes.ToLower(value)
+	}
+
+	runes := utf8.RuneCount(value)
+	if part.maxWidth > 0 && runes > part.maxWidth {
+		if part.truncEnd {
+			value = truncateRunes(value, part.maxWidth)
+		} else {
+			value = value[len(truncateRunes(value, runes-part.maxWidth)):]
+		}
+		runes = part.maxWidth
+	}
+
+	// value may alias *buf, but append copies with overlap handled correctly
+	*buf = append((*buf)[:start], value...)
+
+	padding := part.minWidth - runes
+	if padding <= 0 {
+		return
+	}
+	for i := 0; i < padding; i++ {
+		*buf = append(*buf, ' ')
+	}
+	if !part.leftAlign {
+		padded := (*buf)[start:]
+		copy(padded[padding:], padded[:len(padded)-padding])
+		for i := 0; i < padding; i++ {
+			padded[i] = ' '
 		}
 	}
 }
 
+// truncateRunes returns the first n runes of b
+func truncateRunes(b []byte, n int) []byte {
+	i := 0
+	for ; n > 0 && i < len(b); n-- {
+		_, size := utf8.DecodeRune(b[i:])
+		i += size
+	}
+	return b[:i]
+}
+
+func (f *StringFormatter) requiredFields() entryFields {
+	return f.fields
+}
+
 func (f *StringFormatter) SetTimeFormat(timeFormat string) {
 	f.timeFormat = timeFormat
 }
@@ -111,22 +401,97 @@ func (f *StringFormatter) SetLines(lines bool) {
 	// NOOP
 }
 
-func appendData(msg string, data Data) string {
-	var buf bytes.Buffer
-	buf.WriteString(msg)
-	for key, value := range data {
-		buf.WriteRune(' ')
-		buf.WriteString(key)
-		buf.WriteRune('=')
-		stringData, isString := value.(string)
-		if isString {
-			buf.WriteRune('"')
-			buf.WriteString(stringData)
-			buf.WriteRune('"')
+// appendData renders data as key=value pairs, each preceded by a space. The entry's
+// error (at errKey) is left out, since it is rendered separately by appendErrorBlock.
+func appendData(buf *[]byte, data Data, errKey string) {
+	var scratch [16]string
+	for _, key := range sortedKeys(data, scratch[:0]) {
+		if errKey != "" && key == errKey {
+			continue
+		}
+		*buf = append(*buf, ' ')
+		*buf = append(*buf, key...)
+		*buf = append(*buf, '=')
+		switch value := data[key].(type) {
+		case string:
+			*buf = append(*buf, '"')
+			*buf = append(*buf, value...)
+			*buf = append(*buf, '"')
+		case error:
+			*buf = append(*buf, '"')
+			*buf = append(*buf, value.Error()...)
+			*buf = append(*buf, '"')
+		default:
+			appendPlainValue(buf, value)
+		}
+	}
+}
+
+// appendDataValue renders a single data value. Missing values render as nothing.
+func appendDataValue(buf *[]byte, value interface{}) {
+	switch v := value.(type) {
+	case nil:
+	case string:
+		*buf = append(*buf, v...)
+	case error:
+		*buf = append(*buf, v.Error()...)
+	default:
+		appendPlainValue(buf, v)
+	}
+}
+
+// appendPlainValue renders value as fmt's %v would, without going through fmt for basic types
+func appendPlainValue(buf *[]byte, value interface{}) {
+	switch v := value.(type) {
+	case bool:
+		*buf = strconv.AppendBool(*buf, v)
+	case int:
+		*buf = strconv.AppendInt(*buf, int64(v), 10)
+	case int8:
+		*buf = strconv.AppendInt(*buf, int64(v), 10)
+	case int16:
+		*buf = strconv.AppendInt(*buf, int64(v), 10)
+	case int32:
+		*buf = strconv.AppendInt(*buf, int64(v), 10)
+	case int64:
+		*buf = strconv.AppendInt(*buf, v, 10)
+	case uint:
+		*buf = strconv.AppendUint(*buf, uint64(v), 10)
+	case uint8:
+		*buf = strconv.AppendUint(*buf, uint64(v), 10)
+	case uint16:
+		*buf = strconv.AppendUint(*buf, uint64(v), 10)
+	case uint32:
+		*buf = strconv.AppendUint(*buf, uint64(v), 10)
+	case uint64:
+		*buf = strconv.AppendUint(*buf, v, 10)
+	case float32:
+		*buf = strconv.AppendFloat(*buf, float64(v), 'g', -1, 32)
+	case float64:
+		*buf = strconv.AppendFloat(*buf, v, 'g', -1, 64)
+	default:
+		*buf = append(*buf, fmt.Sprint(v)...)
+	}
+}
+
+// appendErrorBlock renders an error chain and a stack trace as an indented block
+// on the lines following the log message.
+func appendErrorBlock(buf *[]byte, err error, stack []uintptr) {
+	for i, msg := range errorChain(err) {
+		if i == 0 {
+			*buf = append(*buf, "\n\terror: "...)
 		} else {
-			// TODO: faster way of doing this
-			buf.WriteString(fmt.Sprintf("%v", value))
+			*buf = append(*buf, "\n\tcaused by: "...)
+		}
+		*buf = append(*buf, strings.Replace(msg, "\n", "\n\t\t", -1)...)
+	}
+
+	frames := stackFrames(stack)
+	if len(frames) > 0 {
+		*buf = append(*buf, "\n\tstacktrace:"...)
+		for _, frame := range frames {
+			*buf = append(*buf, "\n\t\t"...)
+			*buf = append(*buf, frame...)
 		}
 	}
-	return buf.String()
 }
@@ -1,11 +1,17 @@
 package log5go
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"net"
 	"os"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 )
 
 var socketTypes = []string{"unixgram", "unix"}
@@ -55,109 +61,715 @@ const (
 	SyslogLocal7
 )
 
+// Defaults for syslog reconnection and buffering
+const (
+	DefaultSyslogBacklog      = 1000                   // messages kept while disconnected
+	DefaultSyslogMinBackoff   = 100 * time.Millisecond // delay before the first reconnection attempt
+	DefaultSyslogMaxBackoff   = 30 * time.Second       // maximum delay between reconnection attempts
+	DefaultSyslogWriteTimeout = 5 * time.Second        // maximum time a message may take to be written
+)
+
+// SyslogProtocol selects the format of syslog messages
+type SyslogProtocol int
+
+// syslog protocols
+const (
+	SyslogRFC5424 SyslogProtocol = iota // RFC 5424 with structured data, the default
+	SyslogRFC3164                       // classic BSD syslog, for older relays
+)
+
+// SyslogFraming selects how messages are delimited on a stream connection (RFC 6587)
+type SyslogFraming int
+
+// syslog framing methods
+const (
+	SyslogNonTransparent SyslogFraming = iota // each message ends with a newline
+	SyslogOctetCounting                       // each message is preceded by its length
+)
+
+// SyslogHostname selects how the HOSTNAME of syslog messages is found
+type SyslogHostname int
+
+// syslog hostname sources
+const (
+	SyslogHostnameFQDN  SyslogHostname = iota // fully qualified domain name, falling back to IP, the default
+	SyslogHostnameShort                       // hostname without the domain
+	SyslogHostnameIP                          // local IP address of the connection to syslogd
+)
+
+// DefaultSyslogSDID is the SD-ID of the structured data element that holds a message's
+// data. 32473 is the private enterprise number reserved for documentation (RFC 5612);
+// organizations with their own number should set it with WithSyslogHeader().
+const DefaultSyslogSDID = "meta@32473"
+
+// SyslogMsgID is the MSGID of a single message, set with a SyslogMsgIDKey data value
+type SyslogMsgID string
+
+// SyslogMsgIDKey is the data key that sets the MSGID of a single message. Its value
+// must be a SyslogMsgID, like SyslogMsgID("LOGIN"), and is sent in the header instead
+// of the structured data. Other values under this key are ordinary data.
+const SyslogMsgIDKey = "msgid"
+
+// SyslogFacilityKey is the data key that sets the facility of a single message. Its value
+// must be a SyslogPriority facility, like SyslogAuth, and is sent in the header instead
+// of the message's data.
+const SyslogFacilityKey = "facility"
+
+// SyslogSeverityFunc maps a log level to a syslog severity, like SyslogWarning
+type SyslogSeverityFunc func(level LogLevel) SyslogPriority
+
+// SyslogHeader holds the RFC 5424 header fields set by the application. Empty fields
+// keep their current value.
+type SyslogHeader struct {
+	Hostname string // HOSTNAME, looked up as set by WithSyslogHostname() by default
+	AppName  string // APP-NAME, the tag given to ToLocalSyslog() or ToRemoteSyslog() by default
+	ProcID   string // PROCID, the process ID by default
+	MsgID    string // MSGID, none by default
+	SDID     string // SD-ID of the element holding message data, DefaultSyslogSDID by default
+}
+
+// RFC 5424 allows at most microsecond precision
+const (
+	syslogTimeFormat       = "2006-01-02T15:04:05.000000Z07:00"
+	maxSyslogTimePrecision = 6
+)
+
+// maximum lengths of RFC 5424 header fields
+const (
+	maxSyslogHostname = 255
+	maxSyslogAppName  = 48
+	maxSyslogProcID   = 128
+	maxSyslogMsgID    = 32
+	maxSyslogSDName   = 32
+)
+
+// RFC 3164 limits
+const (
+	maxRFC3164Length = 1024 // whole message, including the trailing newline
+	maxRFC3164Tag    = 32
+)
+
+// timeout for connecting to syslogd. Appends block while connecting, so keep it short.
+var syslogDialTimeout = 5 * time.Second
+
+// timeout for the DNS lookups of the host's FQDN, done when the appender is built
+var syslogLookupTimeout = 2 * time.Second
+
 type syslogAppender struct {
 	sync.Mutex
-	conn     net.Conn
-	facility SyslogPriority
-	tag      string
-	hostname string
+	conn      net.Conn
+	dial      func() (net.Conn, error) // (re)connects to syslogd
+	facility  SyslogPriority
+	severity  SyslogSeverityFunc // nil for DefaultSyslogSeverity
+	hostname  string             // hostname looked up when the appender was built, "" to use localAddr
+	localAddr string             // local IP address used as hostname, until the next reconnection
+	source    SyslogHostname     // how hostname was looked up
+	header    SyslogHeader
+	utc       bool
+	tsFormat  string
+	protocol  SyslogProtocol
+	framing   SyslogFraming
+	line      []byte        // buffer for the syslog line being written
+	frame     []byte        // buffer for the octet-counted frame being written
+	timeout   time.Duration // maximum time a write may take, 0 for none
+
+	// reconnection and buffering
+	backlog     [][]byte      // lines that couldn't be sent, oldest first
+	maxBacklog  int           // maximum number of lines in backlog
+	dropped     int           // lines dropped from a full backlog since the connection was lost
+	fallback    Appender      // receives lines while the connection is down
+	minBackoff  time.Duration // initial delay between reconnection attempts
+	maxBackoff  time.Duration // maximum delay between reconnection attempts
+	backoff     time.Duration // current delay between reconnection attempts
+	nextAttempt time.Time     // time of the next reconnection attempt
 }
 
+func newSyslogAppender(dial func() (net.Conn, error), facility SyslogPriority, tag string, framing SyslogFraming) *syslogAppender {
+	return &syslogAppender{
+		dial:       dial,
+		facility:   facility,
+		framing:    framing,
+		tsFormat:   syslogTimeFormat,
+		header:     SyslogHeader{AppName: tag, ProcID: strconv.Itoa(pid), SDID: DefaultSyslogSDID},
+		maxBacklog: DefaultSyslogBacklog,
+		fallback:   newWriterAppender(os.Stderr, nil),
+		minBackoff: DefaultSyslogMinBackoff,
+		maxBackoff: DefaultSyslogMaxBackoff,
+		timeout:    DefaultSyslogWriteTimeout,
+	}
+}
+
+// Append sends a message to syslogd. If the connection is down, the message is written
+// to the fallback appender and kept in the backlog, which is sent once a reconnection
+// attempt succeeds. Reconnection is attempted on Append, with exponential backoff.
 func (a *syslogAppender) Append(msg *[]byte, level LogLevel, tstamp time.Time) error {
+	return a.appendEntry(msg, &Entry{Level: level, Time: tstamp})
+}
+
+// appendEntry sends an RFC 5424 message, with the entry's data as structured data
+func (a *syslogAppender) appendEntry(msg *[]byte, e *Entry) error {
 	a.Lock()
 	defer a.Unlock()
 
 	TerminateMessageWithNewline(msg)
 
-	// sanity check
-	if a.conn == nil {
-		return fmt.Errorf("connection is not established")
+	a.line = a.format(a.line[:0], e, *msg)
+	return a.send(a.line, *msg, e.Level, e.Time)
+}
+
+// format appends the syslog line for e, with msg as the free-form message
+func (a *syslogAppender) format(line []byte, e *Entry, msg []byte) []byte {
+	pri := a.priority(e)
+	if a.protocol == SyslogRFC3164 {
+		return a.appendRFC3164(line, pri, e, msg)
+	}
+
+	msgID := a.header.MsgID
+	if id, ok := e.Data[SyslogMsgIDKey].(SyslogMsgID); ok {
+		msgID = string(id)
+	}
+
+	line = a.appendHeader(line, pri, e.Time, msgID)
+	line = appendStructuredData(line, a.header.SDID, e.Data)
+	line = append(line, ' ')
+	return append(line, msg...)
+}
+
+// priority returns the PRI of e: the facility, unless its data sets another, and the
+// severity of its level
+func (a *syslogAppender) priority(e *Entry) SyslogPriority {
+	facility := a.facility
+	if f, ok := e.Data[SyslogFacilityKey].(SyslogPriority); ok && validFacility(f) {
+		facility = f
+	}
+	if a.severity == nil {
+		return calculatePriority(facility, e.Level)
+	}
+	return facility | a.severity(e.Level)&7
+}
+
+// syslogHeaderData returns true for data values that are sent in the RFC 5424 header
+// rather than as structured data
+func syslogHeaderData(key string, value interface{}) bool {
+	switch key {
+	case SyslogMsgIDKey:
+		_, ok := value.(SyslogMsgID)
+		return ok
+	case SyslogFacilityKey:
+		_, ok := value.(SyslogPriority)
+		return ok
+	}
+	return false
+}
+
+// appendRFC3164 appends a BSD syslog line: <pri>Mmm dd hh:mm:ss host tag[pid]: msg.
+// Data is added to the message as key=value pairs, and the line is truncated to 1024 bytes.
+func (a *syslogAppender) appendRFC3164(line []byte, pri SyslogPriority, e *Entry, msg []byte) []byte {
+	start := len(line)
+	line = append(line, '<')
+	line = strconv.AppendInt(line, int64(pri), 10)
+	line = append(line, '>')
+	line = a.timestamp(e.Time).AppendFormat(line, time.Stamp)
+	line = appendHeaderField(line, a.calculateHostname(), maxSyslogHostname)
+	line = append(line, ' ')
+	tagStart := len(line)
+	line = appendRFC3164Tag(line, a.header.AppName)
+	if len(line) > tagStart {
+		line = append(line, '[')
+		line = append(line, a.header.ProcID...)
+		line = append(line, "]: "...)
+	}
+	line = append(line, bytes.TrimSuffix(msg, []byte{'\n'})...)
+	skip := ""
+	if _, ok := e.Data[SyslogFacilityKey].(SyslogPriority); ok {
+		skip = SyslogFacilityKey
+	}
+	appendData(&line, e.Data, skip)
+
+	if len(line)-start >= maxRFC3164Length {
+		// don't cut a UTF-8 character in half
+		end := start + maxRFC3164Length - 1
+		for end > start && !utf8.RuneStart(line[end]) {
+			end--
+		}
+		line = line[:end]
+	}
+	return append(line, '\n')
+}
+
+// appendRFC3164Tag appends up to 32 characters of tag. RFC 3164 tags are alphanumeric,
+// as any other character starts the message. '-', '_', '.' and '/' are kept, as common
+// syslogds accept them; other characters are dropped.
+func appendRFC3164Tag(line []byte, tag string) []byte {
+	n := 0
+	for i := 0; i < len(tag) && n < maxRFC3164Tag; i++ {
+		c := tag[i]
+		if ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '/' {
+			line = append(line, c)
+			n++
+		}
+	}
+	return line
+}
+
+// appendHeader appends the RFC 5424 header, from PRI to MSGID
+func (a *syslogAppender) appendHeader(line []byte, pri SyslogPriority, tstamp time.Time, msgID string) []byte {
+	line = append(line, '<')
+	line = strconv.AppendInt(line, int64(pri), 10)
+	line = append(line, ">1 "...)
+	line = a.timestamp(tstamp).AppendFormat(line, a.tsFormat)
+	line = appendHeaderField(line, a.calculateHostname(), maxSyslogHostname)
+	line = appendHeaderField(line, a.header.AppName, maxSyslogAppName)
+	line = appendHeaderField(line, a.header.ProcID, maxSyslogProcID)
+	line = appendHeaderField(line, msgID, maxSyslogMsgID)
+	return line
+}
+
+func (a *syslogAppender) timestamp(tstamp time.Time) time.Time {
+	if a.utc {
+		return tstamp.UTC()
+	}
+	return tstamp
+}
+
+// syslogTimeLayout returns the RFC 5424 time layout with precision fractional digits
+func syslogTimeLayout(precision int) string {
+	if precision <= 0 {
+		return "2006-01-02T15:04:05Z07:00"
+	}
+	if precision > maxSyslogTimePrecision {
+		precision = maxSyslogTimePrecision
+	}
+	return "2006-01-02T15:04:05." + strings.Repeat("0", precision) + "Z07:00"
+}
+
+// appendHeaderField appends a space and a header field, truncated to maxLen. Header
+// fields are printable ASCII, so anything else is replaced with '_'. An empty field
+// is sent as NILVALUE.
+func appendHeaderField(line []byte, field string, maxLen int) []byte {
+	line = append(line, ' ')
+	if field == "" {
+		return append(line, '-')
+	}
+	if len(field) > maxLen {
+		field = field[:maxLen]
+	}
+	for i := 0; i < len(field); i++ {
+		c := field[i]
+		if c < '!' || c > '~' {
+			c = '_'
+		}
+		line = append(line, c)
+	}
+	return line
+}
+
+// appendStructuredData appends a space and data as an SD-ELEMENT, like
+// [meta@32473 key="value"], or NILVALUE if there is no data
+func appendStructuredData(line []byte, sdID string, data Data) []byte {
+	line = append(line, ' ')
+	n := 0
+	for key, value := range data {
+		if !syslogHeaderData(key, value) {
+			n++
+		}
+	}
+	if n == 0 || sdID == "" {
+		return append(line, '-')
+	}
+
+	line = append(line, '[')
+	line = appendSDName(line, sdID)
+	var scratch [16]string
+	for _, key := range sortedKeys(data, scratch[:0]) {
+		value := data[key]
+		if syslogHeaderData(key, value) {
+			continue
+		}
+		line = append(line, ' ')
+		line = appendSDName(line, key)
+		line = append(line, '=', '"')
+		start := len(line)
+		appendDataValue(&line, value)
+		if bytes.ContainsAny(line[start:], `"\]`) {
+			unescaped := string(line[start:])
+			line = line[:start]
+			for i := 0; i < len(unescaped); i++ {
+				if c := unescaped[i]; c == '"' || c == '\\' || c == ']' {
+					line = append(line, '\\')
+				}
+				line = append(line, unescaped[i])
+			}
+		}
+		line = append(line, '"')
+	}
+	return append(line, ']')
+}
+
+// appendSDName appends an SD-ID or PARAM-NAME, which are at most 32 printable ASCII
+// characters other than '=', ' ', ']' and '"'. Other characters are replaced with '_'.
+func appendSDName(line []byte, name string) []byte {
+	if name == "" {
+		return append(line, '_')
+	}
+	if len(name) > maxSyslogSDName {
+		name = name[:maxSyslogSDName]
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c < '!' || c > '~' || c == '=' || c == ']' || c == '"' {
+			c = '_'
+		}
+		line = append(line, c)
+	}
+	return line
+}
+
+// send writes line to syslogd, handling reconnection and buffering. While syslogd is
+// unreachable, msg, the formatted message without the syslog header, goes to the
+// fallback appender. Caller must hold the lock.
+func (a *syslogAppender) send(line []byte, msg []byte, level LogLevel, tstamp time.Time) error {
+	now := time.Now()
+	if a.conn == nil && !now.Before(a.nextAttempt) {
+		a.reconnect(now)
 	}
 
-	pri := calculatePriority(a.facility, level)
-	hostname := a.calculateHostname()
+	if a.conn != nil {
+		err := a.write(line)
+		if err == nil {
+			return nil
+		}
+
+		// the connection is broken. syslogd may have restarted, so try once more right away,
+		// unless the write timed out: a stalled syslogd gets the backoff before we retry.
+		a.disconnect(err, tstamp)
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			a.scheduleReconnect(now)
+		} else if a.reconnect(now) {
+			if err = a.write(line); err == nil {
+				return nil
+			}
+			a.disconnect(err, tstamp)
+			a.scheduleReconnect(now)
+		}
+	}
 
-	_, err := fmt.Fprintf(a.conn, "<%d>1 %s %s %s[%d]: %s", pri, tstamp.Format(time.RFC3339Nano), hostname, a.tag, os.Getpid(), *msg)
+	a.buffer(line)
+	if a.fallback == nil {
+		return fmt.Errorf("syslog connection is down")
+	}
+	fallbackMsg := append([]byte(nil), msg...)
+	return a.fallback.Append(&fallbackMsg, level, tstamp)
+}
+
+// write sends a single line on the connection, framing it if necessary. The write fails
+// if it takes longer than the timeout, so a stalled syslogd can't block the logger.
+// Caller must hold the lock.
+func (a *syslogAppender) write(line []byte) error {
+	if a.framing == SyslogOctetCounting {
+		line = bytes.TrimSuffix(line, []byte{'\n'})
+		a.frame = strconv.AppendInt(a.frame[:0], int64(len(line)), 10)
+		a.frame = append(a.frame, ' ')
+		a.frame = append(a.frame, line...)
+		line = a.frame
+	}
+	if a.timeout > 0 {
+		a.conn.SetWriteDeadline(time.Now().Add(a.timeout))
+	}
+	_, err := a.conn.Write(line)
 	return err
 }
 
+// reconnect attempts to connect to syslogd and send the backlog, returning true on
+// success. On failure, the next attempt is scheduled. Caller must hold the lock.
+func (a *syslogAppender) reconnect(now time.Time) bool {
+	if a.dial == nil {
+		return false
+	}
+
+	conn, err := a.dial()
+	if err != nil {
+		a.scheduleReconnect(now)
+		return false
+	}
+	a.conn = conn
+	a.localAddr = "" // the connection may use another interface
+
+	if a.dropped > 0 {
+		msg := fmt.Sprintf("log5go: %d messages were dropped while syslog was unreachable\n", a.dropped)
+		notice := a.format(nil, &Entry{Level: LogWarn, Time: now}, []byte(msg))
+		a.backlog = append([][]byte{notice}, a.backlog...)
+	}
+	for len(a.backlog) > 0 {
+		if err := a.write(a.backlog[0]); err != nil {
+			a.conn.Close()
+			a.conn = nil
+			a.scheduleReconnect(now)
+			return false
+		}
+		a.backlog[0] = nil
+		a.backlog = a.backlog[1:]
+	}
+	a.backlog = nil
+	a.dropped = 0
+	a.backoff = 0
+	return true
+}
+
+func (a *syslogAppender) scheduleReconnect(now time.Time) {
+	if a.backoff == 0 {
+		a.backoff = a.minBackoff
+	} else if a.backoff *= 2; a.backoff > a.maxBackoff {
+		a.backoff = a.maxBackoff
+	}
+	a.nextAttempt = now.Add(a.backoff)
+}
+
+// disconnect closes a broken connection and reports the error to the fallback appender.
+// Caller must hold the lock.
+func (a *syslogAppender) disconnect(cause error, tstamp time.Time) {
+	a.conn.Close()
+	a.conn = nil
+	if a.fallback != nil {
+		notice := []byte(fmt.Sprintf("log5go: lost connection to syslog: %v\n", cause))
+		a.fallback.Append(&notice, LogError, tstamp)
+	}
+}
+
+// buffer keeps a copy of line in the backlog, dropping the oldest line if it is full
+func (a *syslogAppender) buffer(line []byte) {
+	if a.maxBacklog <= 0 {
+		a.dropped++
+		return
+	}
+	if len(a.backlog) >= a.maxBacklog {
+		a.backlog[0] = nil
+		a.backlog = a.backlog[1:]
+		a.dropped++
+	}
+	a.backlog = append(a.backlog, append([]byte(nil), line...))
+}
+
+// syslogFraming returns the default framing for a transport: octet counting for stream
+// transports, none for datagrams
+func syslogFraming(transport string) SyslogFraming {
+	switch transport {
+	case "tcp", "tcp4", "tcp6", "unix":
+		return SyslogOctetCounting
+	}
+	return SyslogNonTransparent
+}
+
+// dialLocalSyslog connects to the local syslogd's socket
+func dialLocalSyslog() (conn net.Conn, err error) {
+	for _, transport := range socketTypes {
+		for _, socket := range socketLocations {
+			conn, err = net.DialTimeout(transport, socket, syslogDialTimeout)
+			if err == nil {
+				return conn, nil
+			}
+		}
+	}
+	return nil, err
+}
+
+func (a *syslogAppender) Concurrent() bool {
+	return true
+}
+
+// calculateHostname returns the HOSTNAME of messages: the one set with WithSyslogHeader,
+// the one looked up when the appender was built or, failing that, the local IP address.
+// No DNS lookups are done here, as the caller holds the lock. Caller must hold the lock.
 func (a *syslogAppender) calculateHostname() string {
+	if a.header.Hostname != "" {
+		return a.header.Hostname
+	}
 	if a.hostname != "" {
 		return a.hostname
 	}
+	if a.localAddr == "" {
+		a.localAddr = a.localIP()
+	}
+	if a.localAddr == "" {
+		if host, err := os.Hostname(); err == nil && host != "" {
+			return host
+		}
+		return "unknown-host" // everything failed
+	}
+	return a.localAddr
+}
+
+// lookupSyslogHostname looks up the hostname as selected by source, or returns "" if
+// the local IP address should be used. It may query DNS, so it must not be called
+// with the appender's lock held.
+func lookupSyslogHostname(source SyslogHostname) string {
+	switch source {
+	case SyslogHostnameFQDN:
+		return lookupFQDN(syslogLookupTimeout)
+	case SyslogHostnameShort:
+		if host, err := os.Hostname(); err == nil && host != "" {
+			if i := strings.IndexByte(host, '.'); i > 0 {
+				host = host[:i]
+			}
+			return host
+		}
+	}
+	return ""
+}
+
+// localIP returns the local address of the connection to syslogd or, for Unix sockets,
+// the first non-loopback IPv4 address. Caller must hold the lock.
+func (a *syslogAppender) localIP() string {
+	if a.conn != nil {
+		switch addr := a.conn.LocalAddr().(type) {
+		case *net.TCPAddr:
+			return addr.IP.String()
+		case *net.UDPAddr:
+			return addr.IP.String()
+		}
+	}
 
-	// try to get local IP
 	addrs, err := net.InterfaceAddrs()
 	if err != nil {
-		// unlikely to happen, but nothing we can do
+		return ""
 	}
 	for _, address := range addrs {
-		// check the address type and if it is not a loopback the display it
-		if ipnet, ok := address.(*net.IPNet); ok && !ipnet.IP.IsLoopback() {
-			if ipnet.IP.To4() != nil {
-				a.hostname = ipnet.IP.String()
-				return a.hostname
-			}
+		if ipnet, ok := address.(*net.IPNet); ok && !ipnet.IP.IsLoopback() && ipnet.IP.To4() != nil {
+			return ipnet.IP.String()
 		}
 	}
+	return ""
+}
 
-	// try to use hostname if we can't get an IP addr
+// lookupFQDN returns the host's fully qualified domain name, or "" if it has none or
+// DNS doesn't answer within timeout
+func lookupFQDN(timeout time.Duration) string {
 	host, err := os.Hostname()
-	if err == nil {
-		a.hostname = host
-		return a.hostname
+	if err != nil || host == "" {
+		return ""
+	}
+	if strings.IndexByte(host, '.') > 0 {
+		return host
 	}
 
-	// everything failed. just put something in a.addr so we don't call method over and over
-	a.hostname = "unknown-host"
-	return a.hostname
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		return ""
+	}
+	for _, addr := range addrs {
+		names, err := net.DefaultResolver.LookupAddr(ctx, addr)
+		if err != nil {
+			continue
+		}
+		for _, name := range names {
+			name = strings.TrimSuffix(name, ".")
+			if strings.HasPrefix(name, host+".") {
+				return name
+			}
+		}
+	}
+	return ""
 }
 
+// syslogFormatter formats the free-form message of syslog messages. Data is left out,
+// as the syslog appender sends it as structured data.
 type syslogFormatter struct {
-	formatter *StringFormatter
+	formatter *StringFormatter // for messages with a prefix
+	noPrefix  *StringFormatter // for messages without one
 }
 
 func newSyslogFormatter(lines bool) Formatter {
-	var inner *StringFormatter
 	if lines {
-		inner = NewStringFormatter("%p (%c:%n): %m")
-	} else {
-		inner = NewStringFormatter("%p: %m")
+		return &syslogFormatter{
+			formatter: NewStringFormatter("%p (%c:%n): %m"),
+			noPrefix:  NewStringFormatter("(%c:%n): %m"),
+		}
+	}
+	return &syslogFormatter{
+		formatter: NewStringFormatter("%p: %m"),
+		noPrefix:  NewStringFormatter("%m"),
 	}
-
-	return &syslogFormatter{formatter: inner}
 }
 
 func (f *syslogFormatter) Format(tstamp time.Time, level LogLevel, prefix, caller string, line uint, msg string, data Data, out *[]byte) {
-	f.formatter.Format(tstamp, level, prefix, caller, line, msg, data, out)
+	f.FormatEntry(newEntry(tstamp, level, prefix, caller, line, msg, data), out)
+}
+
+func (f *syslogFormatter) FormatEntry(e *Entry, out *[]byte) {
+	entry := *e
+	entry.Data = nil
+	if e.Prefix == "" {
+		f.noPrefix.FormatEntry(&entry, out)
+	} else {
+		f.formatter.FormatEntry(&entry, out)
+	}
+}
+
+func (f *syslogFormatter) requiredFields() entryFields {
+	return f.formatter.requiredFields() | f.noPrefix.requiredFields()
 }
 
 func (f *syslogFormatter) SetTimeFormat(timeFormat string) {
-	// NOOP
+	// NOOP: the time is sent in the syslog header, see WithSyslogTime()
 }
 
 func (f *syslogFormatter) SetLines(lines bool) {
 	f.formatter.SetLines(lines)
+	f.noPrefix.SetLines(lines)
 }
 
 func calculatePriority(facility SyslogPriority, level LogLevel) SyslogPriority {
+	return facility | DefaultSyslogSeverity(level)
+}
+
+// DefaultSyslogSeverity maps log levels to syslog severities. Levels with a severity set
+// by NewLevel() use it; other levels map to the severity of the next standard level up,
+// so both LogTrace and LogDebug are debug and LogFatal is emerg.
+func DefaultSyslogSeverity(level LogLevel) SyslogPriority {
+	if severity, ok := levelSeverity(level); ok {
+		return severity
+	}
+
 	switch {
 	case level <= LogDebug:
-		return facility | SyslogDebug
+		return SyslogDebug
 	case level <= LogInfo:
-		return facility | SyslogInfo
+		return SyslogInfo
 	case level <= LogNotice:
-		return facility | SyslogNotice
+		return SyslogNotice
 	case level <= LogWarn:
-		return facility | SyslogWarning
+		return SyslogWarning
 	case level <= LogError:
-		return facility | SyslogError
+		return SyslogError
 	case level <= LogCritical:
-		return facility | SyslogCritical
+		return SyslogCritical
 	case level <= LogAlert:
-		return facility | SyslogAlert
+		return SyslogAlert
 	default:
-		return facility | SyslogEmergency
+		return SyslogEmergency
 
 	}
 }
+
+// SyslogSeverityTable returns a severity mapping for WithSyslogSeverity() that looks levels
+// up in table. Levels missing from table use DefaultSyslogSeverity.
+func SyslogSeverityTable(table map[LogLevel]SyslogPriority) SyslogSeverityFunc {
+	c := make(map[LogLevel]SyslogPriority, len(table))
+	for level, severity := range table {
+		c[level] = severity
+	}
+	return func(level LogLevel) SyslogPriority {
+		if severity, ok := c[level]; ok {
+			return severity
+		}
+		return DefaultSyslogSeverity(level)
+	}
+}
+
+// validFacility returns true if f is one of the syslog facilities
+func validFacility(f SyslogPriority) bool {
+	return f >= SyslogKernel && f <= SyslogLocal7 && f&7 == 0
+}
@@ -0,0 +1,652 @@
+package log5go
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var rxSyslogLine = regexp.MustCompile(`(?s)^<134>1 \S+ \S+ app \d+ - - (.*?)\n?$`)
+
+// syslogMessage extracts the message from a syslog line sent with facility LOCAL0 at INFO.
+// The line may be a frame without the trailing newline.
+func syslogMessage(t *testing.T, line string) string {
+	m := rxSyslogLine.FindStringSubmatch(line)
+	if m == nil {
+		t.Errorf("unexpected syslog line %q", line)
+		return ""
+	}
+	return m[1]
+}
+
+func TestSyslogUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip("can't listen on UDP: ", err)
+	}
+	defer conn.Close()
+
+	l := Logger(LogAll).ToRemoteSyslog(SyslogLocal0, "app", "udp", conn.LocalAddr().String())
+	l.Info("hello")
+
+	buf := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", syslogMessage(t, string(buf[:n])))
+}
+
+func TestSyslogTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip("can't listen on TCP: ", err)
+	}
+	defer ln.Close()
+
+	l := Logger(LogAll).ToRemoteSyslog(SyslogLocal0, "app", "tcp", ln.Addr().String()).WithPrefix("web")
+	conn, err := ln.Accept()
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	l.Info("first")
+	l.Info("second\n\tline two")
+
+	r := bufio.NewReader(conn)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	for _, expected := range []string{"web: first", "web: second\n\tline two"} {
+		frame, err := readSyslogFrame(r)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, syslogMessage(t, frame))
+	}
+}
+
+// readSyslogFrame reads an octet-counted frame: the message length, a space and the message
+func readSyslogFrame(r *bufio.Reader) (string, error) {
+	length, err := r.ReadString(' ')
+	if err != nil {
+		return "", err
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(length, " "))
+	if err != nil {
+		return "", err
+	}
+	frame := make([]byte, n)
+	_, err = io.ReadFull(r, frame)
+	return string(frame), err
+}
+
+func TestSyslogNonTransparentFraming(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip("can't listen on TCP: ", err)
+	}
+	defer ln.Close()
+
+	l := Logger(LogAll).ToRemoteSyslog(SyslogLocal0, "app", "tcp", ln.Addr().String()).
+		WithSyslogFraming(SyslogNonTransparent)
+	conn, err := ln.Accept()
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	l.Info("first")
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equal(t, "first", syslogMessage(t, line))
+}
+
+func TestSyslogTLS(t *testing.T) {
+	cert, pool := selfSignedCert(t)
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Skip("can't listen on TCP: ", err)
+	}
+	defer ln.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			conn.(*tls.Conn).Handshake()
+			accepted <- conn
+		}
+	}()
+
+	l := Logger(LogAll).ToRemoteSyslogTLS(SyslogLocal0, "app", ln.Addr().String(), &tls.Config{RootCAs: pool, ServerName: "localhost"})
+	l.Info("secret\nstack")
+
+	var conn net.Conn
+	select {
+	case conn = <-accepted:
+	case <-time.After(time.Second):
+		t.Fatal("no TLS connection")
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	frame, err := readSyslogFrame(bufio.NewReader(conn))
+	assert.NoError(t, err)
+	assert.Equal(t, "secret\nstack", syslogMessage(t, frame))
+}
+
+func TestSyslogTLSRejectsUntrustedServer(t *testing.T) {
+	cert, _ := selfSignedCert(t)
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Skip("can't listen on TCP: ", err)
+	}
+	defer ln.Close()
+	go func() {
+		if conn, err := ln.Accept(); err == nil {
+			conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+
+	l := Logger(LogAll).ToRemoteSyslogTLS(SyslogLocal0, "app", ln.Addr().String(), &tls.Config{ServerName: "localhost"})
+	a, ok := l.(*logger).appender.(*syslogAppender)
+	if assert.True(t, ok) {
+		assert.Nil(t, a.conn, "connected to an untrusted server")
+	}
+}
+
+// selfSignedCert creates a certificate for localhost and a pool that trusts it
+func selfSignedCert(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(parsed)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
+
+func TestSyslogReconnect(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.sock")
+	listen := func() *net.UnixConn {
+		conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+		if err != nil {
+			t.Skip("can't listen on unixgram socket: ", err)
+		}
+		return conn
+	}
+	read := func(conn *net.UnixConn) string {
+		buf := make([]byte, 1024)
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, err := conn.Read(buf)
+		assert.NoError(t, err)
+		return syslogMessage(t, string(buf[:n]))
+	}
+
+	server := listen()
+	var fallback bytes.Buffer
+	l := Logger(LogAll).WithFmt("%m").ToRemoteSyslog(SyslogLocal0, "app", "unixgram", path).
+		WithSyslogFallback(NewWriterAppender(&fallback)).
+		WithSyslogBackoff(time.Millisecond, 5*time.Millisecond)
+
+	l.Info("one")
+	assert.Equal(t, "one", read(server))
+
+	// syslogd goes away
+	server.Close()
+	os.Remove(path)
+	l.Info("two")
+	assert.Contains(t, fallback.String(), "lost connection to syslog")
+	assert.Contains(t, fallback.String(), "\ntwo\n")
+	assert.NotContains(t, fallback.String(), " app ", "fallback got the syslog header")
+
+	// and comes back
+	server = listen()
+	defer server.Close()
+	time.Sleep(10 * time.Millisecond)
+	l.Info("three")
+	assert.Equal(t, "two", read(server), "backlog wasn't replayed")
+	assert.Equal(t, "three", read(server))
+}
+
+// recordingConn is a net.Conn that records writes, or fails them
+type recordingConn struct {
+	net.Conn
+	writes [][]byte
+	fail   bool
+}
+
+func (c *recordingConn) Write(b []byte) (int, error) {
+	if c.fail {
+		return 0, errors.New("write failed")
+	}
+	c.writes = append(c.writes, append([]byte(nil), b...))
+	return len(b), nil
+}
+
+func (c *recordingConn) Close() error {
+	return nil
+}
+
+func (c *recordingConn) LocalAddr() net.Addr {
+	return &net.UDPAddr{IP: net.IPv4(192, 0, 2, 7), Port: 40000}
+}
+
+func (c *recordingConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+func TestSyslogBacklogIsBounded(t *testing.T) {
+	var conn *recordingConn
+	a := newSyslogAppender(func() (net.Conn, error) {
+		if conn == nil {
+			return nil, errors.New("connection refused")
+		}
+		return conn, nil
+	}, SyslogLocal0, "app", SyslogNonTransparent)
+	a.fallback = nil
+	a.maxBacklog = 2
+	a.minBackoff = 0
+
+	for _, msg := range []string{"a", "b", "c", "d"} {
+		m := []byte(msg)
+		assert.Error(t, a.Append(&m, LogInfo, time.Now()))
+	}
+	assert.Len(t, a.backlog, 2)
+	assert.Equal(t, 2, a.dropped)
+
+	conn = &recordingConn{}
+	m := []byte("e")
+	assert.NoError(t, a.Append(&m, LogInfo, time.Now()))
+
+	var messages []string
+	for _, w := range conn.writes {
+		messages = append(messages, regexp.MustCompile(`^<\d+>1 \S+ \S+ app \d+ - - (.*)\n$`).FindStringSubmatch(string(w))[1])
+	}
+	assert.Equal(t, []string{"log5go: 2 messages were dropped while syslog was unreachable", "c", "d", "e"}, messages)
+	assert.Empty(t, a.backlog)
+	assert.Equal(t, 0, a.dropped)
+}
+
+func TestSyslogBacklogIsFramed(t *testing.T) {
+	var conn *recordingConn
+	a := newSyslogAppender(func() (net.Conn, error) {
+		if conn == nil {
+			return nil, errors.New("connection refused")
+		}
+		return conn, nil
+	}, SyslogLocal0, "app", SyslogOctetCounting)
+	a.fallback = nil
+	a.maxBacklog = 1
+	a.minBackoff = 0
+
+	for _, msg := range []string{"a", "b"} {
+		m := []byte(msg)
+		assert.Error(t, a.Append(&m, LogInfo, time.Now()))
+	}
+
+	conn = &recordingConn{}
+	m := []byte("c")
+	assert.NoError(t, a.Append(&m, LogInfo, time.Now()))
+
+	var messages []string
+	for _, w := range conn.writes {
+		frame := regexp.MustCompile(`^(\d+) (<\d+>1 \S+ \S+ app \d+ - - (.*))$`).FindStringSubmatch(string(w))
+		if !assert.NotNil(t, frame, "unframed message %q", w) {
+			return
+		}
+		assert.Equal(t, strconv.Itoa(len(frame[2])), frame[1])
+		messages = append(messages, frame[3])
+	}
+	assert.Equal(t, []string{"log5go: 1 messages were dropped while syslog was unreachable", "b", "c"}, messages)
+}
+
+func TestSyslogBackoff(t *testing.T) {
+	attempts := 0
+	a := newSyslogAppender(func() (net.Conn, error) {
+		attempts++
+		return nil, errors.New("connection refused")
+	}, SyslogLocal0, "app", SyslogNonTransparent)
+	a.fallback = nil
+	a.minBackoff = time.Second
+	a.maxBackoff = 3 * time.Second
+
+	now := time.Now()
+	var delays []time.Duration
+	for i := 0; i < 4; i++ {
+		a.reconnect(now)
+		delays = append(delays, a.nextAttempt.Sub(now))
+	}
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second}, delays)
+
+	// appends before the next attempt don't redial
+	attempts = 0
+	m := []byte("x")
+	a.Append(&m, LogInfo, now)
+	assert.Equal(t, 0, attempts)
+}
+
+func TestSyslogBrokenConnection(t *testing.T) {
+	broken := &recordingConn{fail: true}
+	fresh := &recordingConn{}
+	a := newSyslogAppender(func() (net.Conn, error) {
+		return fresh, nil
+	}, SyslogLocal0, "app", SyslogNonTransparent)
+	a.conn = broken
+	var fallback bytes.Buffer
+	a.fallback = NewWriterAppender(&fallback)
+
+	m := []byte("retried")
+	assert.NoError(t, a.Append(&m, LogInfo, time.Now()))
+	assert.Len(t, fresh.writes, 1, "message wasn't sent after reconnecting")
+	assert.Contains(t, fallback.String(), "lost connection to syslog: write failed")
+	assert.NotContains(t, fallback.String(), "retried")
+}
+
+func TestSyslogStalledConnection(t *testing.T) {
+	// nothing reads from the other end of the pipe, so writes block until the deadline
+	stalled, server := net.Pipe()
+	defer server.Close()
+	dials := 0
+	a := newSyslogAppender(func() (net.Conn, error) {
+		dials++
+		return &recordingConn{}, nil
+	}, SyslogLocal0, "app", SyslogNonTransparent)
+	a.conn = stalled
+	a.timeout = 20 * time.Millisecond
+	a.minBackoff = time.Minute
+	var fallback bytes.Buffer
+	a.fallback = NewWriterAppender(&fallback)
+
+	start := time.Now()
+	m := []byte("stalled")
+	assert.NoError(t, a.Append(&m, LogInfo, time.Now()))
+	assert.Less(t, time.Since(start), time.Second, "append blocked on a stalled connection")
+	assert.Contains(t, fallback.String(), "lost connection to syslog")
+	assert.Contains(t, fallback.String(), "\nstalled\n")
+	assert.Len(t, a.backlog, 1)
+	assert.Equal(t, 0, dials, "reconnected without backing off")
+}
+
+// syslogLine logs with a syslog logger writing to a fake connection and returns the line sent
+func syslogLine(t *testing.T, configure func(l Log5Go) Log5Go, log func(l Log5Go)) string {
+	conn := &recordingConn{}
+	l := Logger(LogAll)
+	l.(*logger).toSyslog(func() (net.Conn, error) { return conn, nil }, SyslogLocal0, "app", SyslogNonTransparent)
+	log(configure(l))
+	if !assert.Len(t, conn.writes, 1) {
+		return ""
+	}
+	return string(conn.writes[0])
+}
+
+func TestSyslogRFC5424(t *testing.T) {
+	rx := regexp.MustCompile(`^<134>1 (\S+) \S+ app (\d+) - - hello\n$`)
+	line := syslogLine(t, func(l Log5Go) Log5Go { return l }, func(l Log5Go) { l.Info("hello") })
+	m := rx.FindStringSubmatch(line)
+	if !assert.NotNil(t, m, "unexpected syslog line %q", line) {
+		return
+	}
+	assert.Regexp(t, `^\d{4}-\d\d-\d\dT\d\d:\d\d:\d\d\.\d{6}(Z|[+-]\d\d:\d\d)$`, m[1])
+	assert.Equal(t, strconv.Itoa(os.Getpid()), m[2])
+}
+
+func TestSyslogStructuredData(t *testing.T) {
+	var tests = []struct {
+		data     Data
+		expected string
+	}{
+		{Data{"user": "bob", "count": 3}, `[meta@32473 count="3" user="bob"] hello`},
+		{Data{"path": `C:\tmp`, "quote": `say "hi"`, "list": "[a]"}, `[meta@32473 list="[a\]" path="C:\\tmp" quote="say \"hi\""] hello`},
+		{Data{"bad key=": "x", "nil": nil}, `[meta@32473 bad_key_="x" nil=""] hello`},
+		{Data{"error": errors.New("boom")}, `[meta@32473 error="boom"] hello`},
+		{Data{SyslogMsgIDKey: SyslogMsgID("LOGIN")}, `- hello`},
+		{Data{"msgid": "<1234@example.com>"}, `[meta@32473 msgid="<1234@example.com>"] hello`},
+	}
+
+	for _, test := range tests {
+		line := syslogLine(t, func(l Log5Go) Log5Go { return l }, func(l Log5Go) { l.WithData(test.data).Info("hello") })
+		assert.True(t, strings.HasSuffix(line, " "+test.expected+"\n"), "expected %q in %q", test.expected, line)
+	}
+}
+
+func TestSyslogHeader(t *testing.T) {
+	configure := func(l Log5Go) Log5Go {
+		return l.WithPrefix("web").WithSyslogHeader(SyslogHeader{AppName: "my app", ProcID: "worker-1", MsgID: "REQ", SDID: "req@12345"})
+	}
+
+	line := syslogLine(t, configure, func(l Log5Go) { l.WithData(Data{"id": 7}).Info("hello") })
+	assert.Regexp(t, `^<134>1 \S+ \S+ my_app worker-1 REQ \[req@12345 id="7"\] web: hello\n$`, line)
+
+	line = syslogLine(t, configure, func(l Log5Go) { l.WithData(Data{SyslogMsgIDKey: SyslogMsgID("LOGIN")}).Info("hello") })
+	assert.Regexp(t, `^<134>1 \S+ \S+ my_app worker-1 LOGIN - web: hello\n$`, line)
+
+	// a plain string under the key is data, and doesn't change MSGID
+	line = syslogLine(t, configure, func(l Log5Go) { l.WithData(Data{SyslogMsgIDKey: "<42@example.com>"}).Info("hello") })
+	assert.Regexp(t, `^<134>1 \S+ \S+ my_app worker-1 REQ \[req@12345 msgid="<42@example.com>"\] web: hello\n$`, line)
+}
+
+func TestSyslogHeaderFieldsAreSanitized(t *testing.T) {
+	assert.Equal(t, " -", string(appendHeaderField(nil, "", maxSyslogAppName)))
+	assert.Equal(t, " a_b_c", string(appendHeaderField(nil, "a b\tc", maxSyslogAppName)))
+	assert.Equal(t, " "+strings.Repeat("x", maxSyslogMsgID), string(appendHeaderField(nil, strings.Repeat("x", 40), maxSyslogMsgID)))
+}
+
+func TestSyslogRFC3164(t *testing.T) {
+	rfc3164 := func(l Log5Go) Log5Go { return l.WithSyslogProtocol(SyslogRFC3164) }
+
+	line := syslogLine(t, rfc3164, func(l Log5Go) { l.WithData(Data{"user": "bob"}).Info("hello") })
+	assert.Regexp(t, `^<134>[A-Z][a-z]{2} [ \d]\d \d\d:\d\d:\d\d \S+ app\[\d+\]: hello user="bob"\n$`, line)
+
+	line = syslogLine(t, rfc3164, func(l Log5Go) { l.Info(strings.Repeat("x", 2000)) })
+	assert.Len(t, line, maxRFC3164Length)
+	assert.True(t, strings.HasSuffix(line, "x\n"))
+
+	// multibyte characters aren't cut in half
+	line = syslogLine(t, rfc3164, func(l Log5Go) { l.Info(strings.Repeat("é", 1000)) })
+	assert.True(t, len(line) <= maxRFC3164Length)
+	assert.True(t, utf8.ValidString(line))
+}
+
+func TestSyslogRFC3164Timestamp(t *testing.T) {
+	a := &syslogAppender{hostname: "host", header: SyslogHeader{AppName: "app", ProcID: "42"}, protocol: SyslogRFC3164}
+	tstamp := time.Date(2024, time.March, 5, 7, 8, 9, 123456789, time.Local)
+	line := a.format(nil, &Entry{Level: LogInfo, Time: tstamp}, []byte("hello\n"))
+	assert.Equal(t, "<6>Mar  5 07:08:09 host app[42]: hello\n", string(line))
+}
+
+func TestSyslogRFC3164Tag(t *testing.T) {
+	var tests = map[string]string{
+		"app":                           "app",
+		"postfix/smtpd":                 "postfix/smtpd",
+		"my app:[1]":                    "myapp1",
+		strings.Repeat("abcdefghij", 4): strings.Repeat("abcdefghij", 3) + "ab",
+		"":                              "",
+	}
+	for tag, expected := range tests {
+		assert.Equal(t, expected, string(appendRFC3164Tag(nil, tag)))
+	}
+
+	a := &syslogAppender{hostname: "host", header: SyslogHeader{AppName: ":::", ProcID: "42"}, protocol: SyslogRFC3164}
+	line := a.format(nil, &Entry{Level: LogInfo, Time: time.Now()}, []byte("hello\n"))
+	assert.Regexp(t, `^<6>.{15} host hello\n$`, string(line))
+}
+
+func TestSyslogOctetCounting(t *testing.T) {
+	conn := &recordingConn{}
+	a := newSyslogAppender(nil, SyslogLocal0, "app", SyslogOctetCounting)
+	a.conn = conn
+
+	m := []byte("héllo\nworld")
+	assert.NoError(t, a.Append(&m, LogInfo, time.Now()))
+	frame := string(conn.writes[0])
+	i := strings.IndexByte(frame, ' ')
+	assert.Equal(t, strconv.Itoa(len(frame)-i-1), frame[:i])
+	assert.True(t, strings.HasSuffix(frame, " héllo\nworld"), frame)
+}
+
+func TestSyslogFramingForTransport(t *testing.T) {
+	assert.Equal(t, SyslogOctetCounting, syslogFraming("tcp"))
+	assert.Equal(t, SyslogOctetCounting, syslogFraming("unix"))
+	assert.Equal(t, SyslogNonTransparent, syslogFraming("udp"))
+	assert.Equal(t, SyslogNonTransparent, syslogFraming("unixgram"))
+}
+
+func TestDefaultSyslogSeverity(t *testing.T) {
+	var tests = map[LogLevel]SyslogPriority{
+		LogTrace:    SyslogDebug,
+		LogDebug:    SyslogDebug,
+		LogInfo:     SyslogInfo,
+		LogNotice:   SyslogNotice,
+		LogWarn:     SyslogWarning,
+		450:         SyslogError,
+		LogError:    SyslogError,
+		LogCritical: SyslogCritical,
+		LogAlert:    SyslogAlert,
+		LogFatal:    SyslogEmergency,
+	}
+	for level, expected := range tests {
+		assert.Equal(t, expected, DefaultSyslogSeverity(level), "level %d", level)
+	}
+}
+
+func TestSyslogSeverityMapping(t *testing.T) {
+	table := map[LogLevel]SyslogPriority{450: SyslogNotice, LogFatal: SyslogCritical}
+	severity := SyslogSeverityTable(table)
+	table[LogInfo] = SyslogEmergency // the table is copied
+	configure := func(l Log5Go) Log5Go { return l.WithSyslogSeverity(severity) }
+
+	line := syslogLine(t, configure, func(l Log5Go) { l.Log(450, "audit") })
+	assert.True(t, strings.HasPrefix(line, "<133>1 "), line) // LOCAL0.notice
+	line = syslogLine(t, configure, func(l Log5Go) { l.Info("info") })
+	assert.True(t, strings.HasPrefix(line, "<134>1 "), line) // LOCAL0.info
+
+	debug := func(l Log5Go) Log5Go {
+		return l.WithSyslogSeverity(func(level LogLevel) SyslogPriority { return SyslogDebug })
+	}
+	line = syslogLine(t, debug, func(l Log5Go) { l.Error("error") })
+	assert.True(t, strings.HasPrefix(line, "<135>1 "), line) // LOCAL0.debug
+}
+
+func TestSyslogFacilityOverride(t *testing.T) {
+	none := func(l Log5Go) Log5Go { return l }
+
+	line := syslogLine(t, none, func(l Log5Go) { l.WithData(Data{SyslogFacilityKey: SyslogAuth, "user": "bob"}).Warn("login failed") })
+	assert.Regexp(t, `^<36>1 .* - \[meta@32473 user="bob"\] login failed\n$`, line) // AUTH.warning
+
+	// invalid facilities are ignored, and other types are just data
+	line = syslogLine(t, none, func(l Log5Go) { l.WithData(Data{SyslogFacilityKey: SyslogPriority(3)}).Warn("x") })
+	assert.True(t, strings.HasPrefix(line, "<132>1 "), line)
+	line = syslogLine(t, none, func(l Log5Go) { l.WithData(Data{SyslogFacilityKey: "auth"}).Warn("x") })
+	assert.Regexp(t, `^<132>1 .* \[meta@32473 facility="auth"\] x\n$`, line)
+
+	rfc3164 := func(l Log5Go) Log5Go { return l.WithSyslogProtocol(SyslogRFC3164) }
+	line = syslogLine(t, rfc3164, func(l Log5Go) { l.WithData(Data{SyslogFacilityKey: SyslogAuth, "user": "bob"}).Warn("login failed") })
+	assert.Regexp(t, `^<36>.* login failed user="bob"\n$`, line)
+}
+
+func TestSyslogHostname(t *testing.T) {
+	host, _ := os.Hostname()
+	short := host
+	if i := strings.IndexByte(host, '.'); i > 0 {
+		short = host[:i]
+	}
+
+	var tests = []struct {
+		configure func(l Log5Go) Log5Go
+		expected  string
+	}{
+		{func(l Log5Go) Log5Go { return l.WithSyslogHostname(SyslogHostnameIP) }, "192.0.2.7"},
+		{func(l Log5Go) Log5Go { return l.WithSyslogHostname(SyslogHostnameShort) }, short},
+		{func(l Log5Go) Log5Go { return l.WithSyslogHeader(SyslogHeader{Hostname: "web-1.example.com"}) }, "web-1.example.com"},
+	}
+	for _, test := range tests {
+		line := syslogLine(t, test.configure, func(l Log5Go) { l.Info("hello") })
+		assert.Equal(t, test.expected, strings.Fields(line)[2])
+	}
+
+	// the default is the FQDN, or else the connection's IP
+	expected := lookupFQDN(syslogLookupTimeout)
+	if expected == "" {
+		expected = "192.0.2.7"
+	}
+	line := syslogLine(t, func(l Log5Go) Log5Go { return l }, func(l Log5Go) { l.Info("hello") })
+	assert.Equal(t, expected, strings.Fields(line)[2])
+}
+
+func TestSyslogLocalAddrIsLookedUpOnReconnect(t *testing.T) {
+	a := newSyslogAppender(func() (net.Conn, error) { return &recordingConn{}, nil }, SyslogLocal0, "app", SyslogNonTransparent)
+	a.source = SyslogHostnameIP
+	a.localAddr = "stale"
+	assert.True(t, a.reconnect(time.Now()))
+	assert.Equal(t, "192.0.2.7", a.calculateHostname())
+}
+
+func TestSyslogHostnameIsKeptOnReconnect(t *testing.T) {
+	a := newSyslogAppender(func() (net.Conn, error) { return &recordingConn{}, nil }, SyslogLocal0, "app", SyslogNonTransparent)
+	a.hostname = "web-1.example.com"
+	assert.True(t, a.reconnect(time.Now()))
+	assert.Equal(t, "web-1.example.com", a.calculateHostname())
+}
+
+func TestSyslogTime(t *testing.T) {
+	tstamp := time.Date(2024, time.March, 5, 7, 8, 9, 123456789, time.FixedZone("CET", 3600))
+	var tests = []struct {
+		utc       bool
+		precision int
+		expected  string
+	}{
+		{false, 6, "2024-03-05T07:08:09.123456+01:00"},
+		{true, 6, "2024-03-05T06:08:09.123456Z"},
+		{true, 3, "2024-03-05T06:08:09.123Z"},
+		{false, 0, "2024-03-05T07:08:09+01:00"},
+		{true, 9, "2024-03-05T06:08:09.123456Z"},
+	}
+	for _, test := range tests {
+		conn := &recordingConn{}
+		l := Logger(LogAll)
+		l.(*logger).toSyslog(func() (net.Conn, error) { return conn, nil }, SyslogLocal0, "app", SyslogNonTransparent)
+		l.WithSyslogTime(test.utc, test.precision)
+
+		m := []byte("hello")
+		l.(*logger).appender.Append(&m, LogInfo, tstamp)
+		assert.Equal(t, test.expected, strings.Fields(string(conn.writes[0]))[1])
+	}
+
+	a := &syslogAppender{hostname: "host", header: SyslogHeader{AppName: "app", ProcID: "42"}, protocol: SyslogRFC3164, utc: true}
+	line := a.format(nil, &Entry{Level: LogInfo, Time: tstamp}, []byte("hello\n"))
+	assert.Equal(t, "<6>Mar  5 06:08:09 host app[42]: hello\n", string(line))
+}
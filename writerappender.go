@@ -7,18 +7,35 @@ import (
 )
 
 type writerAppender struct {
-	lock    sync.Mutex
-	dest    io.Writer
-	errDest io.Writer
+	lock      sync.Mutex
+	dest      io.Writer
+	errDest   io.Writer
+	errFilter Filter // selects messages for errDest. nil for WARN and above
+	color     bool   // destination(s) can display colors
+}
+
+func newWriterAppender(dest, errDest io.Writer) *writerAppender {
+	a := &writerAppender{dest: dest, errDest: errDest}
+	a.color = supportsColor(dest) && (errDest == nil || supportsColor(errDest))
+	return a
+}
+
+// NewWriterAppender creates an appender that writes to w, for use with WithAppender()
+func NewWriterAppender(w io.Writer) Appender {
+	return newWriterAppender(w, nil)
 }
 
 func (a *writerAppender) Append(msg *[]byte, level LogLevel, tstamp time.Time) (err error) {
+	return a.appendEntry(msg, &Entry{Level: level, Time: tstamp})
+}
+
+func (a *writerAppender) appendEntry(msg *[]byte, e *Entry) (err error) {
 	a.lock.Lock()
 	defer a.lock.Unlock()
 
 	TerminateMessageWithNewline(msg)
 
-	if a.errDest != nil && level >= LogWarn {
+	if a.errDest != nil && a.isError(e) {
 		_, err = a.errDest.Write(*msg)
 	} else {
 		_, err = a.dest.Write(*msg)
@@ -26,3 +43,24 @@ func (a *writerAppender) Append(msg *[]byte, level LogLevel, tstamp time.Time) (
 
 	return err
 }
+
+// isError returns true iff e should be written to errDest
+func (a *writerAppender) isError(e *Entry) bool {
+	if a.errFilter == nil {
+		return e.Level >= LogWarn
+	}
+	return a.errFilter(*e)
+}
+
+func (a *writerAppender) Concurrent() bool {
+	return true
+}
+
+// colorEnabled returns true iff appender a writes to a console that can display colors
+func colorEnabled(a Appender) bool {
+	if fa, ok := a.(*filteredAppender); ok {
+		a = fa.appender
+	}
+	wa, ok := a.(*writerAppender)
+	return ok && wa.color
+}